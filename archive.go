@@ -0,0 +1,342 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Archives are used like directories: every image inside them is used,
+// wherever it is in the archive. An image inside an archive is written as the
+// path of the archive joined with its path in the archive, e.g.
+// "C:/Wallpapers/pack.zip/2024/sunset.png". It can be read like any other
+// file through openFile() and statFile(), and is extracted into
+// ArchiveCacheDir() when it is set as the background image
+
+// Returned when an image in an archive cannot be extracted, e.g. the archive
+// changed since it was scanned. Like ErrNoTaggedImages, this does not stop
+// the server
+var ErrExtractImage = errors.New("Kept the current image")
+
+// Megabytes of extracted images kept in ArchiveCacheDir()
+const DefaultArchiveCacheSize uint32 = 512
+
+// Only zip archives are supported
+func IsArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// Images extracted from archives are in the cache next to the config, apart
+// from the derivatives
+func ArchiveCacheDir(configPath string) string {
+	return filepath.Join(CacheDir(configPath), "archives")
+}
+
+// The archive an image is in and its path inside the archive (using "/" as
+// separator). ok is false for images not in an archive
+func SplitArchiveMember(image string) (archive string, member string, ok bool) {
+	slashed := filepath.ToSlash(image)
+	lower := strings.ToLower(slashed)
+	for from := 0; ; {
+		i := strings.Index(lower[from:], ".zip/")
+		if i < 0 {
+			return "", "", false
+		}
+		end := from + i + len(".zip")
+		// a directory can be named like an archive as well
+		if info, err := os.Stat(filepath.FromSlash(slashed[:end])); err == nil && !info.IsDir() {
+			return filepath.FromSlash(slashed[:end]), slashed[end+1:], true
+		}
+		from = end
+	}
+}
+
+// Opens the file at path, which can be in an archive
+func openFile(path string) (io.ReadCloser, error) {
+	if _, _, ok := SplitArchiveMember(path); !ok {
+		return os.Open(path)
+	}
+	reader, file, err := openArchiveMember(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := file.Open()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("Failed to read %s: %s", path, err)
+	}
+	return &archiveMemberReader{ReadCloser: handle, archive: reader}, nil
+}
+
+// Closes the archive along with the file in it
+type archiveMemberReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (r *archiveMemberReader) Close() error {
+	err := r.ReadCloser.Close()
+	if closeErr := r.archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Same as os.Stat() but the path can be of a file in an archive, in which
+// case the size and modification time are the ones stored in the archive
+func statFile(path string) (fs.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		return info, nil
+	}
+	if _, _, ok := SplitArchiveMember(path); !ok {
+		return nil, err
+	}
+	reader, file, err := openArchiveMember(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return file.FileInfo(), nil
+}
+
+// The archive of the file (to be closed by the caller) and the file in it
+func openArchiveMember(image string) (*zip.ReadCloser, *zip.File, error) {
+	archive, member, ok := SplitArchiveMember(image)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not in an archive", image)
+	}
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open archive %s: %s", archive, err)
+	}
+	for _, file := range reader.File {
+		if file.Name == member {
+			return reader, file, nil
+		}
+	}
+	reader.Close()
+	return nil, nil, fmt.Errorf("%s is not in archive %s: %w", member, archive, fs.ErrNotExist)
+}
+
+// Checks that the archive can be read. Only the list of files is read, so an
+// image in it can still be corrupt
+func ValidateArchive(archive string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return fmt.Errorf("Failed to open archive %s: %s", archive, err)
+	}
+	return reader.Close()
+}
+
+// Adds the images in the archive, skipping the ones matching exclude (or any
+// directory they are in) or not matching include. The archive is only opened
+// once, unlike when reading a single file through openFile()
+func (s *scanner) archive(archive string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() || path.Base(file.Name) == SidecarName {
+			continue
+		}
+		full := filepath.Join(archive, filepath.FromSlash(file.Name))
+		// e.g. "../../evil.png", which would be outside of the archive
+		if !filepath.IsLocal(filepath.FromSlash(file.Name)) {
+			s.reject(full, "not inside the archive")
+			continue
+		}
+		rel := s.relative(full)
+		if slices.ContainsFunc(parentsOf(rel), func(p string) bool { return matchesAny(s.exclude, p) }) {
+			s.reject(full, "matches exclude")
+			continue
+		}
+		if len(s.include) > 0 && !matchesAny(s.include, rel) {
+			s.reject(full, "does not match include")
+			continue
+		}
+		info := file.FileInfo()
+		s.add(full, s.index.cachedEntry(full, info, func() IndexEntry {
+			return readIndexEntry(full, info, file.Open)
+		}))
+	}
+	return nil
+}
+
+// "a/b/c.png" and every directory it is in: "a", "a/b"
+func parentsOf(rel string) []string {
+	parents := []string{rel}
+	for i, c := range rel {
+		if c == '/' {
+			parents = append(parents, rel[:i])
+		}
+	}
+	return parents
+}
+
+// File name of the extracted image. It changes when the image in the archive
+// changes so a stale copy is never used
+func extractedName(archive string, file *zip.File) string {
+	sum := sha256.Sum256(fmt.Append(nil,
+		archive, "\x00",
+		file.Name, "\x00",
+		file.UncompressedSize64, "\x00",
+		file.CRC32, "\x00",
+		file.Modified.UnixNano(),
+	))
+	return hex.EncodeToString(sum[:16]) + strings.ToLower(filepath.Ext(file.Name))
+}
+
+// Extracts the image in an archive into cacheDir unless it is already there,
+// returning the path of the copy and whether it was already there
+func ExtractImage(cacheDir string, image string) (string, bool, error) {
+	archive, _, _ := SplitArchiveMember(image)
+	reader, file, err := openArchiveMember(image)
+	if err != nil {
+		return "", false, err
+	}
+	defer reader.Close()
+	extracted := filepath.Join(cacheDir, extractedName(archive, file))
+	if _, err := os.Stat(extracted); err == nil {
+		// the modification time is when it was last used
+		now := time.Now()
+		_ = os.Chtimes(extracted, now, now)
+		return extracted, true, nil
+	}
+	handle, err := file.Open()
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to read %s: %s", image, err)
+	}
+	defer handle.Close()
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", false, fmt.Errorf("Failed to create cache directory: %s", err)
+	}
+	// multiple servers may share the cache so each writes to its own
+	// temporary file before renaming it
+	tmp, err := os.CreateTemp(cacheDir, "extracted_*.tmp")
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to extract %s: %s", image, err)
+	}
+	_, err = io.Copy(tmp, handle)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by the owner
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), extracted)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("Failed to extract %s: %s", image, err)
+	}
+	return extracted, false, nil
+}
+
+// Removes the least recently used images in cacheDir until they take at most
+// limit bytes, never removing keep. Leftover temporary files are removed as
+// well. Returns the number of files removed and their size
+func EvictExtracted(cacheDir string, limit int64, keep string) (int, int64, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Failed to read cache directory: %s", err)
+	}
+	type extractedFile struct {
+		name string
+		info fs.FileInfo
+	}
+	files := make([]extractedFile, 0, len(entries))
+	var total int64
+	var removed int
+	var freed int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			// may still be written by a running server if it is recent
+			if time.Since(info.ModTime()) > time.Hour && os.Remove(filepath.Join(cacheDir, entry.Name())) == nil {
+				removed++
+				freed += info.Size()
+			}
+			continue
+		}
+		files = append(files, extractedFile{name: entry.Name(), info: info})
+		total += info.Size()
+	}
+	slices.SortFunc(files, func(a, b extractedFile) int {
+		return a.info.ModTime().Compare(b.info.ModTime())
+	})
+	for _, file := range files {
+		if total <= limit {
+			break
+		}
+		if filepath.Join(cacheDir, file.name) == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cacheDir, file.name)); err != nil {
+			return removed, freed, fmt.Errorf("Failed to remove %s: %s", file.name, err)
+		}
+		total -= file.info.Size()
+		removed++
+		freed += file.info.Size()
+	}
+	return removed, freed, nil
+}
+
+// returns the archive cache size in bytes if it is set. otherwise, the
+// default size (512 MB)
+func (cfg *Config) ArchiveCacheSizeOrDefault() int64 {
+	return int64(Option(cfg.ArchiveCacheSize).UnwrapOr(DefaultArchiveCacheSize)) << 20
+}
+
+// Path of the extracted copy of an image in an archive, evicting the least
+// recently used copies if the cache is too large. Other images are returned
+// as is
+func (tbg *TbgState) extract(image string) (string, error) {
+	if _, _, ok := SplitArchiveMember(image); !ok {
+		return image, nil
+	}
+	start := time.Now()
+	cacheDir := ArchiveCacheDir(tbg.ConfigPath)
+	extracted, cached, err := ExtractImage(cacheDir, image)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("Extracted image from archive",
+		"image", image,
+		"extracted", extracted,
+		"cached", cached,
+		"took", time.Since(start).Round(time.Millisecond).String(),
+	)
+	if cached {
+		return extracted, nil
+	}
+	removed, freed, err := EvictExtracted(cacheDir, tbg.Config.ArchiveCacheSizeOrDefault(), extracted)
+	if err != nil {
+		slog.Warn("Failed to evict extracted images", "error", err)
+	}
+	if removed > 0 {
+		slog.Info("Evicted extracted images",
+			"removed", removed,
+			"freed", fmt.Sprintf("%.1f MB", float64(freed)/(1<<20)),
+		)
+	}
+	return extracted, nil
+}
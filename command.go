@@ -34,6 +34,30 @@ func ToCommand(s string) (Command, error) {
 		return new(SetImageCommand), nil
 	case "quit":
 		return new(QuitCommand), nil
+	case "status":
+		return new(StatusCommand), nil
+	case "events":
+		return new(EventsCommand), nil
+	case "previous-image":
+		return new(PreviousImageCommand), nil
+	case "forward-image":
+		return new(ForwardImageCommand), nil
+	case "history":
+		return new(HistoryCommand), nil
+	case "pause":
+		return new(PauseCommand), nil
+	case "resume":
+		return new(ResumeCommand), nil
+	case "index":
+		return new(IndexCommand), nil
+	case "schedule":
+		return new(ScheduleCommand), nil
+	case "tags":
+		return new(TagsCommand), nil
+	case "list":
+		return new(ListCommand), nil
+	case "cache":
+		return new(CacheCommand), nil
 	default:
 		return nil, fmt.Errorf("unknown command: %s", s)
 	}
@@ -52,6 +76,18 @@ const (
 	NextImageCommandType
 	SetImageCommandType
 	QuitCommandType
+	StatusCommandType
+	EventsCommandType
+	PauseCommandType
+	ResumeCommandType
+	PreviousImageCommandType
+	ForwardImageCommandType
+	HistoryCommandType
+	IndexCommandType
+	ScheduleCommandType
+	TagsCommandType
+	ListCommandType
+	CacheCommandType
 )
 
 func (c CommandType) String() string {
@@ -76,6 +112,30 @@ func (c CommandType) String() string {
 		return "set-image"
 	case QuitCommandType:
 		return "quit"
+	case StatusCommandType:
+		return "status"
+	case EventsCommandType:
+		return "events"
+	case PauseCommandType:
+		return "pause"
+	case ResumeCommandType:
+		return "resume"
+	case PreviousImageCommandType:
+		return "previous-image"
+	case ForwardImageCommandType:
+		return "forward-image"
+	case HistoryCommandType:
+		return "history"
+	case IndexCommandType:
+		return "index"
+	case ScheduleCommandType:
+		return "schedule"
+	case TagsCommandType:
+		return "tags"
+	case ListCommandType:
+		return "list"
+	case CacheCommandType:
+		return "cache"
 	default:
 		return fmt.Sprintf("UNKNOWN COMMAND '%d'", c)
 	}
@@ -105,6 +165,30 @@ func (c CommandType) ToCommand() Command {
 		return new(SetImageCommand)
 	case QuitCommandType:
 		return new(QuitCommand)
+	case StatusCommandType:
+		return new(StatusCommand)
+	case EventsCommandType:
+		return new(EventsCommand)
+	case PauseCommandType:
+		return new(PauseCommand)
+	case ResumeCommandType:
+		return new(ResumeCommand)
+	case PreviousImageCommandType:
+		return new(PreviousImageCommand)
+	case ForwardImageCommandType:
+		return new(ForwardImageCommand)
+	case HistoryCommandType:
+		return new(HistoryCommand)
+	case IndexCommandType:
+		return new(IndexCommand)
+	case ScheduleCommandType:
+		return new(ScheduleCommand)
+	case TagsCommandType:
+		return new(TagsCommand)
+	case ListCommandType:
+		return new(ListCommand)
+	case CacheCommandType:
+		return new(CacheCommand)
 	default: // case: NoCommandType
 		return nil
 	}
@@ -17,7 +17,7 @@ type AddCommand struct {
 	Config    *string
 	Alignment *string
 	Stretch   *string
-	Opacity   *float32
+	Opacity   *Opacity
 }
 
 func (cmd *AddCommand) Type() CommandType { return AddCommandType }
@@ -48,9 +48,20 @@ func (cmd *AddCommand) ValidateValue(val *string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to normalize path %s: %s", *val, err)
 	}
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
 		return fmt.Errorf("%s does not exist: %s", *val, err.Error())
 	}
+	// an image or a playlist
+	if err == nil && !info.IsDir() {
+		path := ImagesPath{Path: absPath}
+		if _, err := path.Images(nil, ImageFilter{Formats: SupportedFormats}); err != nil {
+			return err
+		}
+		cmd.Path = *val
+		cmd.CleanPath = absPath
+		return nil
+	}
 	hasImageFile := false
 	err = filepath.WalkDir(absPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
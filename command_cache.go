@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+)
+
+type CacheCommand struct {
+	// what to do with the cache. Only "clean" for now
+	Action string
+	// path to a custom config file
+	Config *string
+}
+
+func (cmd *CacheCommand) Type() CommandType { return CacheCommandType }
+
+func (cmd *CacheCommand) String() {
+	fmt.Println("Cache Command:", cmd.Type())
+	fmt.Println("Action:", cmd.Action)
+	if cmd.Config != nil {
+		fmt.Println("Flags:")
+		fmt.Println(" ", ConfigFlag, *cmd.Config)
+	}
+}
+
+func (cmd *CacheCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return fmt.Errorf("'cache' must have an argument. got none")
+	}
+	switch *val {
+	case "clean":
+		cmd.Action = *val
+		return nil
+	default:
+		return fmt.Errorf("invalid arg for 'cache': '%s'. valid args: clean", *val)
+	}
+}
+
+func (cmd *CacheCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case ConfigFlag:
+		val, err := ValidateConfig(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Config = val
+	default:
+		return fmt.Errorf("invalid flag for 'cache': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *CacheCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'cache' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+// Removes the derivatives that are no longer used by the paths of the config.
+// Derivatives of other configs in the same directory are removed as well
+func (cmd *CacheCommand) Execute() error {
+	config, configPath, err := ConfigInit(cmd.Config)
+	if err != nil {
+		return err
+	}
+	index := NewImageIndex(IndexPath(configPath))
+	// a missing or outdated index is filled as the paths are scanned
+	_ = index.read()
+	result, err := CleanCache(config, configPath, index)
+	if err != nil {
+		return err
+	}
+	if err := index.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("removed %d files (%.1f MB), kept %d derivatives in %s\n",
+		result.Removed, float64(result.Freed)/(1<<20), result.Kept, shrinkHome(CacheDir(configPath)))
+	return nil
+}
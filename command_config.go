@@ -7,7 +7,7 @@ import (
 type ConfigCommand struct {
 	// path to a custom config path
 	Config   *string
-	Interval *uint16
+	Interval *Interval
 	Port     *uint16
 	Profile  *string
 }
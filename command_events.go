@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type EventsCommand struct {
+	Port *uint16
+}
+
+func (cmd *EventsCommand) Type() CommandType { return EventsCommandType }
+
+func (r *EventsCommand) String() {
+	fmt.Println("Events Command:", r.Type())
+}
+
+func (cmd *EventsCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'events' takes no args. got: '%s'", *val)
+}
+
+func (cmd *EventsCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'events': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *EventsCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'events' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+// prints the json data of each event sent by the server, one per line, until
+// the server shuts down
+func (cmd *EventsCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/events", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("events: server responded with %s", resp.Status)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			fmt.Println(data)
+		}
+	}
+	return scanner.Err()
+}
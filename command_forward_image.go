@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type ForwardImageCommand struct {
+	Port *uint16
+}
+
+func (cmd *ForwardImageCommand) Type() CommandType { return ForwardImageCommandType }
+
+func (r *ForwardImageCommand) String() {
+	fmt.Println("Forward Image Command:", r.Type())
+}
+
+func (cmd *ForwardImageCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'forward-image' takes no args. got: '%s'", *val)
+}
+
+func (cmd *ForwardImageCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'forward-image': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *ForwardImageCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'forward-image' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+func (cmd *ForwardImageCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/forward-image", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// e.g. the image is in an archive and cannot be extracted
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	fmt.Println("resp:", resp.Status)
+	return nil
+}
@@ -65,10 +65,22 @@ func (cmd *HelpCommand) Execute() error {
 		RunHelp(false)
 		NextImageHelp(false)
 		SetImageHelp(false)
+		PreviousImageHelp(false)
+		ForwardImageHelp(false)
+		HistoryHelp(false)
+		PauseHelp(false)
+		ResumeHelp(false)
+		TagsHelp(false)
 		QuitHelp(false)
+		StatusHelp(false)
+		EventsHelp(false)
 		AddHelp(false)
 		RemoveHelp(false)
 		ConfigHelp(false)
+		IndexHelp(false)
+		ListHelp(false)
+		CacheHelp(false)
+		ScheduleHelp(false)
 		HelpHelp(false)
 		VersionHelp(false)
 		return nil
@@ -96,6 +108,30 @@ func (cmd *HelpCommand) Execute() error {
 			SetImageHelp(true)
 		case QuitCommandType:
 			QuitHelp(true)
+		case StatusCommandType:
+			StatusHelp(true)
+		case EventsCommandType:
+			EventsHelp(true)
+		case PreviousImageCommandType:
+			PreviousImageHelp(true)
+		case ForwardImageCommandType:
+			ForwardImageHelp(true)
+		case HistoryCommandType:
+			HistoryHelp(true)
+		case IndexCommandType:
+			IndexHelp(true)
+		case ListCommandType:
+			ListHelp(true)
+		case CacheCommandType:
+			CacheHelp(true)
+		case ScheduleCommandType:
+			ScheduleHelp(true)
+		case PauseCommandType:
+			PauseHelp(true)
+		case ResumeCommandType:
+			ResumeHelp(true)
+		case TagsCommandType:
+			TagsHelp(true)
 		}
 		fmt.Println("------------------------------------------------------------------------------------")
 	}
@@ -117,14 +153,14 @@ func RunHelp(verbose bool) {
   You can specify alignment, stretch, and opacity using flags.
   These will override the values in the used config (not edit)
   1. -a, --alignment [arg]
-         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight]
+         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight, auto]
   2. -c, --config [arg]
          [/path/to/custom/config.yml]
          Use the custom config instead of the default one.
   3. -o, --opacity   [arg]
-         [any float between 0 and 1 (inclusive)]
+         [any float between 0 and 1 (inclusive), auto]
   4. -s, --stretch   [arg]
-         [fill, none, uniform, uniformToFill]
+         [fill, none, uniform, uniformToFill, auto]
   5. -p, --profile   [arg]
          [default, n, profile name]
          Where n is the list index Windows Terminal uses to identify the profile (starting from 1).
@@ -133,8 +169,8 @@ func RunHelp(verbose bool) {
          [any positive integer]
          Port to be used by tbg server to listen to POST requests
   7. -i, --interval  [arg]
-         [any positive integer]
-         Note that this is in seconds
+         [seconds, duration, cron expression]
+         e.g. 1800, 90m, 1d12h, "cron: 0 9 * * mon-fri"
 
   `, Decorate("Key Events").Bold(), `:
   while tbg is running, it accepts optional key events.
@@ -179,22 +215,27 @@ func AddHelp(verbose bool) {
 	if verbose {
 		fmt.Print(`
   `, Decorate("Args").Bold(), `:
-  1. path/to/images/dir
+  1. path/to/images/dir, path/to/image, path/to/archive.zip, path/to/playlist
      Path to images dir should have at least one image
-     file under it. All subdirectories will be ignored.
+     file under it. Subdirectories are ignored unless
+     recursive is set for the path in the config.
+     A path to an image adds just that image. A path to
+     a zip archive adds every image inside it. A path to
+     any other file is read as a playlist: one image
+     path per line. See the config docs for its format.
 
   `, Decorate("Subcommands").Bold(), `: add takes no sub-commands
   `, Decorate("Flags").Bold(), `:
   You can specify alignment, stretch, and opacity using flags. See example 2 and 3
   1. -a, --alignment [arg]
-         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight]
+         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight, auto]
   2. -c, --config [arg]
          [/path/to/custom/config.yml]
          Add the path to the custom config instead of the default one.
   3. -o, --opacity   [arg]
-         [any float between 0 and 1 (inclusive)]
+         [any float between 0 and 1 (inclusive), auto]
   4. -s, --stretch   [arg]
-         [fill, none, uniform, uniformToFill]
+         [fill, none, uniform, uniformToFill, auto]
 
   `, Decorate("Examples").Bold(), `:
   1. tbg add path/to/images/dir
@@ -264,14 +305,14 @@ func RemoveHelp(verbose bool) {
   You can remove alignment, stretch, and opacity flags from a path by specifying flags
   See example 2 and 3
   1. -a, --alignment [arg]
-         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight]
+         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight, auto]
   2. -c, --config [arg]
          [/path/to/custom/config.yml]
          Remove the path from the custom config instead of the default one.
   3. -o, --opacity   [arg]
-         [any float between 0 and 1 (inclusive)]
+         [any float between 0 and 1 (inclusive), auto]
   4. -s, --stretch   [arg]
-         [fill, none, uniform, uniformToFill]
+         [fill, none, uniform, uniformToFill, auto]
 
   `, Decorate("Examples").Bold(), `:
   1. tbg remove path/to/images/dir
@@ -326,8 +367,8 @@ func ConfigHelp(verbose bool) {
   `, Decorate("Subcommands").Bold(), `: config takes no sub-commands
   `, Decorate("Flags").Bold(), `:
   1. -i, --interval  [arg]
-         [any positive integer]
-         Note that this is in seconds.
+         [seconds, duration, cron expression]
+         e.g. 1800, 90m, 1d12h, "cron: 0 9 * * mon-fri"
   2. -c, --config [arg]
          [/path/to/custom/config.yml]
          Print/edit the custom config instead of the default one.
@@ -419,14 +460,23 @@ func NextImageHelp(verbose bool) {
   `, Decorate("Flags").Bold(), `:
   You can specify alignment, stretch, and opacity using flags. See example 2 and 3
   1. -a, --alignment [arg]
-         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight]
+         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight, auto]
   2. -o, --opacity   [arg]
-         [any float between 0 and 1 (inclusive)]
+         [any float between 0 and 1 (inclusive), auto]
   3. -s, --stretch   [arg]
-         [fill, none, uniform, uniformToFill]
+         [fill, none, uniform, uniformToFill, auto]
+  4. -t, --tag   [arg]
+         [tag1,tag2,...]
+         Only use images with at least one of the tags. Can be repeated
+  5. -x, --exclude-tag   [arg]
+         [tag1,tag2,...]
+         Do not use images with any of the tags. Can be repeated
+  Tag flags are used instead of the active tags of the server (see tags) for
+  this image only
 
   `, Decorate("Examples").Bold(), `:
   1. tbg next-image
+  2. tbg next-image --tag calm,focus --exclude-tag bright
 `)
 	}
 }
@@ -445,11 +495,11 @@ func SetImageHelp(verbose bool) {
   `, Decorate("Flags").Bold(), `:
   You can specify alignment, stretch, and opacity using flags. See example 2 and 3
   1. -a, --alignment [arg]
-         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight]
+         [top, topLeft, topRight, left, center, right, bottomLeft, bottom, bottomRight, auto]
   2. -o, --opacity   [arg]
-         [any float between 0 and 1 (inclusive)]
+         [any float between 0 and 1 (inclusive), auto]
   3. -s, --stretch   [arg]
-         [fill, none, uniform, uniformToFill]
+         [fill, none, uniform, uniformToFill, auto]
 
   `, Decorate("Examples").Bold(), `:
   1. tbg next-image
@@ -471,3 +521,364 @@ func QuitHelp(verbose bool) {
 `)
 	}
 }
+
+func StatusHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  status").Bold(),
+		"Prints the current image and settings of the currently running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: status does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -j, --json
+         Print the raw json response of the server instead
+  2. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to query
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg status
+      -------------------------------------------
+      | image:      /path/to/images/dir/image.png
+      | profile:    default
+      | alignment:  center
+      | opacity:    1
+      | stretch:    uniformToFill
+      | port:       9545
+      | interval:   1800
+      | next image: 2025-01-01 15:04:05 (in 12m30s)
+      -------------------------------------------
+  2. tbg status --json
+`)
+	}
+}
+
+func EventsHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  events").Bold(),
+		"Prints image changes of the currently running tbg server as they happen\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: events does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to listen to
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg events
+     Prints one json object per line until the server stops:
+      {"type":"image","time":"...","image":"/path/to/image.png","profile":"default",...,"trigger":"tick"}
+      {"type":"shutdown","time":"..."}
+`)
+	}
+}
+
+func PauseHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  pause").Bold(),
+		"Pauses automatic image changes of the currently running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: pause does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to pause
+
+  Manual image changes through next-image and set-image still work while paused.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg pause
+`)
+	}
+}
+
+func ResumeHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  resume").Bold(),
+		"Resumes automatic image changes of the currently running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: resume does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to resume
+
+  The countdown continues from where it was paused. If the image was changed
+  manually while paused, the full interval is waited instead.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg resume
+`)
+	}
+}
+
+func PreviousImageHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  previous-image").Bold(),
+		"Goes back to the previous image in the history of the currently running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: previous-image does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server
+
+  The image is set with the same alignment, opacity, and stretch it was set with
+  before. Use forward-image to go back to the newer images.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg previous-image
+`)
+	}
+}
+
+func ForwardImageHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  forward-image").Bold(),
+		"Goes forward in the history after going back through previous-image\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: forward-image does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server
+
+  Any new image change after going back discards the images after the current one.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg forward-image
+`)
+	}
+}
+
+func HistoryHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  history").Bold(),
+		"Prints the images previously set by the currently running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: history does not take args
+
+  `, Decorate("Flags").Bold(), `:
+  1. -j, --json
+         Print the raw json response of the server instead
+  2. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to query
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg history
+      ------------------------------------------------------------------
+      |     1. 2025-01-01 15:04:05 /path/to/images/dir/image1.png
+      |        alignment: center, opacity: 1, stretch: uniformToFill
+      |   > 2. 2025-01-01 15:34:05 /path/to/images/dir/image2.png
+      |        alignment: center, opacity: 1, stretch: uniformToFill
+      |     3. 2025-01-01 16:04:05 /path/to/images/dir/image3.png
+      |        alignment: right, opacity: 0.5, stretch: fill
+      ------------------------------------------------------------------
+     The current image is marked with ">"
+`)
+	}
+}
+
+func IndexHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  index").Bold(),
+		"Manages the cache of which files under the paths are images\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `:
+  1. rebuild
+     Scans every path in the config again, opening every file to check if it
+     is an image, and replaces the index with the result. A running tbg server
+     uses the new index on its next image change.
+
+  `, Decorate("Subcommands").Bold(), `: index takes no sub-commands
+  `, Decorate("Flags").Bold(), `:
+  1. -c, --config [arg]
+         [/path/to/custom/config.yml]
+         Rebuild the index with the paths of the custom config instead of the
+         default one. The index is saved next to the config.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg index rebuild
+      ------------------------------------------------------------------
+      | 120 images under ~/Pictures/Wallpapers
+      | 20000 images under //nas/wallpapers
+      | indexed 20120 images out of 20133 files in 41.2s to ~/AppData/Local/tbg/index.json
+      ------------------------------------------------------------------
+`)
+	}
+}
+
+func ScheduleHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  schedule").Bold(),
+		"Shows which rules of the config's schedule are active\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `:
+  1. show
+     Prints every rule of the schedule, marking the active ones with "*",
+     the paths used right now, and when the active rules change next.
+
+  `, Decorate("Subcommands").Bold(), `: schedule takes no sub-commands
+  `, Decorate("Flags").Bold(), `:
+  1. -c, --config [arg]
+         [/path/to/custom/config.yml]
+         Show the schedule of the custom config instead of the default one.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg schedule show
+      ------------------------------------------------------------------
+      | timezone: Local (now: 2025-01-02 19:30 Thu)
+      | schedule:
+      |   * evening: 18:00-06:00, every day, active until 2025-01-03 06:00 Fri (in 10h30m)
+      |       paths: [~/Pictures/dark]
+      |       opacity: 0.2
+      |     weekend: 09:00-18:00, sat sun, starts 2025-01-04 09:00 Sat (in 37h30m)
+      | active now: evening
+      | paths now: ~/Pictures/dark
+      | next change: 2025-01-03 06:00 Fri (in 10h30m) -> none
+      ------------------------------------------------------------------
+`)
+	}
+}
+
+func TagsHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  tags").Bold(),
+		"Shows or changes the tags restricting the images of the running tbg server\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `:
+  1. show
+     Prints the active tags and the number of images with each tag
+  2. set
+     Only use images matching the tags passed through --tag and
+     --exclude-tag until cleared. Persists across restarts of the server
+  3. clear
+     Use every image again
+
+  Images get tags from the "tags" of their path in the config, and from the
+  sidecar file ".tbg.yml" in their directory:
+      ------------------------------------------------------------------
+      | sunset.png:
+      |   tags: [calm, evening]
+      ------------------------------------------------------------------
+
+  `, Decorate("Flags").Bold(), `:
+  1. -t, --tag   [arg]
+         [tag1,tag2,...]
+         Only use images with at least one of the tags. Can be repeated
+  2. -x, --exclude-tag   [arg]
+         [tag1,tag2,...]
+         Do not use images with any of the tags. Can be repeated
+  3. -j, --json
+         Print the raw json response of the server instead
+  4. -P, --port   [arg]
+         [any positive integer]
+         Port of the tbg server to send the request to
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg tags set --tag calm,focus --exclude-tag bright
+      ------------------------------------------------------------------
+      | active: calm, focus (excluding bright)
+      | tags:
+      |     bright: 4
+      |   * calm: 12
+      |   * focus: 30
+      |     fun: 9
+      ------------------------------------------------------------------
+     Active tags are marked with "*"
+  2. tbg tags clear
+`)
+	}
+}
+
+func ListHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  list").Bold(),
+		"Prints the images under each path, or the files that were skipped\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `: list does not take args
+
+  `, Decorate("Subcommands").Bold(), `: list takes no sub-commands
+  `, Decorate("Flags").Bold(), `:
+  1. -r, --rejected
+         Print the files that were skipped and why instead: not an image, a
+         format not in formats, excluded by include/exclude, or outside of
+         min_width, min_height, or aspect_ratio
+  2. -c, --config [arg]
+         [/path/to/custom/config.yml]
+         List the paths of the custom config instead of the default one.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg list
+      ------------------------------------------------------------------
+      | ## ~/Pictures/Wallpapers (2 images, 2 rejected)
+      |   1920x1080   ~/Pictures/Wallpapers/city.png
+      |   3440x1440   ~/Pictures/Wallpapers/mountains.jpg
+      ------------------------------------------------------------------
+  2. tbg list --rejected
+      ------------------------------------------------------------------
+      | ## ~/Pictures/Wallpapers (2 images, 2 rejected)
+      |   ~/Pictures/Wallpapers/icon.png: 32x32 is narrower than min_width 1280
+      |   ~/Pictures/Wallpapers/phone.jpg: 1080x1920 has aspect ratio 0.56, outside aspect_ratio 1.3-2.5
+      ------------------------------------------------------------------
+`)
+	}
+}
+
+func CacheHelp(verbose bool) {
+	fmt.Printf("%-33s%s",
+		Decorate("  cache").Bold(),
+		"Manages the processed copies of images (crop, effects, max_dimensions)\n",
+	)
+	if verbose {
+		fmt.Print(`
+  `, Decorate("Args").Bold(), `:
+  1. clean
+     Removes the copies that are no longer used: ones made before the image
+     or how it is processed changed, ones of images no longer under any
+     path, and unfinished ones. Copies are made again when needed.
+
+  `, Decorate("Subcommands").Bold(), `: cache takes no sub-commands
+  `, Decorate("Flags").Bold(), `:
+  1. -c, --config [arg]
+         [/path/to/custom/config.yml]
+         Keep the copies used by the paths of the custom config instead of the
+         default one. The cache is next to the config so copies used only by
+         other configs in the same directory are removed as well.
+
+  `, Decorate("Examples").Bold(), `:
+  1. tbg cache clean
+      ------------------------------------------------------------------
+      | removed 12 files (84.3 MB), kept 40 derivatives in ~/AppData/Local/tbg/cache
+      ------------------------------------------------------------------
+`)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type HistoryCommand struct {
+	// print the raw json response of the server instead of the human readable
+	// version
+	Json bool
+	Port *uint16
+}
+
+func (cmd *HistoryCommand) Type() CommandType { return HistoryCommandType }
+
+func (r *HistoryCommand) String() {
+	fmt.Println("History Command:", r.Type())
+}
+
+func (cmd *HistoryCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'history' takes no args. got: '%s'", *val)
+}
+
+func (cmd *HistoryCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case JsonFlag:
+		if f.Value != nil && *f.Value != "" {
+			return fmt.Errorf("--json takes no args. got: '%s'", *f.Value)
+		}
+		cmd.Json = true
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'history': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *HistoryCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'history' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+type HistoryResponseBody struct {
+	// position of the current image in Entries
+	Index int `json:"index"`
+	// oldest first
+	Entries []HistoryEntry `json:"entries"`
+}
+
+func (cmd *HistoryCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/history", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("history: server responded with %s", resp.Status)
+	}
+	if cmd.Json {
+		_, err = io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+	var history HistoryResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return fmt.Errorf("Failed to decode response body: %s", err)
+	}
+	history.Log()
+	return nil
+}
+
+// prints the history oldest first, marking the current image with ">"
+func (history *HistoryResponseBody) Log() {
+	if len(history.Entries) == 0 {
+		fmt.Println("# no images set yet")
+		return
+	}
+	for i, entry := range history.Entries {
+		marker := " "
+		if i == history.Index {
+			marker = ">"
+		}
+		fmt.Printf("%s %3d. %s %s\n", marker, i+1, entry.Time.Local().Format(time.DateTime), entry.Image)
+		fmt.Printf("%-7s alignment: %s, opacity: %s, stretch: %s\n", "",
+			entry.Alignment,
+			strconv.FormatFloat(float64(entry.Opacity), 'f', -1, 32),
+			entry.Stretch,
+		)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type IndexCommand struct {
+	// what to do with the index. Only "rebuild" for now
+	Action string
+	// path to a custom config file
+	Config *string
+}
+
+func (cmd *IndexCommand) Type() CommandType { return IndexCommandType }
+
+func (cmd *IndexCommand) String() {
+	fmt.Println("Index Command:", cmd.Type())
+	fmt.Println("Action:", cmd.Action)
+	if cmd.Config != nil {
+		fmt.Println("Flags:")
+		fmt.Println(" ", ConfigFlag, *cmd.Config)
+	}
+}
+
+func (cmd *IndexCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return fmt.Errorf("'index' must have an argument. got none")
+	}
+	switch *val {
+	case "rebuild":
+		cmd.Action = *val
+		return nil
+	default:
+		return fmt.Errorf("invalid arg for 'index': '%s'. valid args: rebuild", *val)
+	}
+}
+
+func (cmd *IndexCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case ConfigFlag:
+		val, err := ValidateConfig(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Config = val
+	default:
+		return fmt.Errorf("invalid flag for 'index': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *IndexCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'index' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+// Scans every path of the config into a new index, replacing the old one. A
+// running server picks it up on its next image change
+func (cmd *IndexCommand) Execute() error {
+	config, configPath, err := ConfigInit(cmd.Config)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	index := NewImageIndex(IndexPath(configPath))
+	// always written, even if empty, so servers drop their old index
+	index.dirty = true
+	total := 0
+	for _, path := range config.Paths {
+		images, counts, err := path.ImagesByFormat(index, config.FilterOf(&path))
+		if err != nil {
+			fmt.Println(Decorate("skipped").Bold(), path.Path, err)
+			continue
+		}
+		fmt.Println(len(images), "images under", path.Path, formatCounts(counts))
+		total += len(images)
+	}
+	files := index.files()
+	if err := index.Save(); err != nil {
+		return err
+	}
+	fmt.Println("indexed", total, "images out of", files, "files in",
+		time.Since(start).Round(time.Millisecond), "to", shrinkHome(index.Path))
+	return nil
+}
+
+// e.g. "(png: 100, webp: 20)" in the order of SupportedFormats
+func formatCounts(counts map[string]int) string {
+	parts := make([]string, 0, len(counts))
+	for _, format := range SupportedFormats {
+		if count, ok := counts[format]; ok {
+			parts = append(parts, fmt.Sprint(format, ": ", count))
+		}
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+type ListCommand struct {
+	// print the skipped files and why instead of the images
+	Rejected bool
+	// path to a custom config file
+	Config *string
+}
+
+func (cmd *ListCommand) Type() CommandType { return ListCommandType }
+
+func (cmd *ListCommand) String() {
+	fmt.Println("List Command:", cmd.Type())
+	fmt.Println("Flags:")
+	fmt.Println(" ", RejectedFlag, cmd.Rejected)
+	if cmd.Config != nil {
+		fmt.Println(" ", ConfigFlag, *cmd.Config)
+	}
+}
+
+func (cmd *ListCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'list' takes no args. got: '%s'", *val)
+}
+
+func (cmd *ListCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case ConfigFlag:
+		val, err := ValidateConfig(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Config = val
+	case RejectedFlag:
+		if f.Value != nil && *f.Value != "" {
+			return fmt.Errorf("--rejected takes no args. got: '%s'", *f.Value)
+		}
+		cmd.Rejected = true
+	default:
+		return fmt.Errorf("invalid flag for 'list': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *ListCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'list' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+// Prints the images under each path of the config with their dimensions, or
+// the files that were skipped and why. Uses and updates the index
+func (cmd *ListCommand) Execute() error {
+	config, configPath, err := ConfigInit(cmd.Config)
+	if err != nil {
+		return err
+	}
+	index := NewImageIndex(IndexPath(configPath))
+	// a missing or outdated index is filled as the paths are scanned
+	_ = index.read()
+	for _, path := range config.Paths {
+		if path.Exec != nil {
+			// no server passes its state, so only TBG_PATH is set. The
+			// output is what is listed below
+			path.runExec(nil)
+		}
+		images, rejected, err := path.Rejected(index, config.FilterOf(&path))
+		fmt.Print(Decorate("## "+path.Path).Bold(), " (", len(images), " images, ", len(rejected), " rejected)\n")
+		if err != nil && len(rejected) == 0 {
+			fmt.Println(" ", err)
+			continue
+		}
+		if cmd.Rejected {
+			for _, rejection := range rejected {
+				fmt.Print("  ", rejection.Path, ": ", rejection.Reason, "\n")
+			}
+			continue
+		}
+		for _, image := range images {
+			fmt.Printf("  %-11s %s\n", imageSize(index, image), image)
+		}
+	}
+	return index.Save()
+}
+
+// e.g. "1920x1080". "?" if the dimensions are unknown
+func imageSize(index *ImageIndex, image string) string {
+	entry := index.Dirs[filepath.Dir(image)][filepath.Base(image)]
+	if entry.Width == 0 || entry.Height == 0 {
+		return "?"
+	}
+	return fmt.Sprint(entry.Width, "x", entry.Height)
+}
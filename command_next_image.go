@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
 )
 
 type NextImageCommand struct {
 	Alignment *string
-	Opacity   *float32
+	Opacity   *Opacity
 	Stretch   *string
 	Port      *uint16
+	// passed through --tag and --exclude-tag. Used instead of the active tags
+	// of the server for this image only
+	Filter TagFilter
 }
 
 func (cmd *NextImageCommand) Type() CommandType { return NextImageCommandType }
@@ -54,6 +59,18 @@ func (cmd *NextImageCommand) ValidateFlag(f Flag) error {
 			return err
 		}
 		cmd.Stretch = val
+	case TagFlag:
+		tags, err := ValidateTags(f.Type, f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Filter.Tags = append(cmd.Filter.Tags, tags...)
+	case ExcludeTagFlag:
+		tags, err := ValidateTags(f.Type, f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Filter.ExcludeTags = append(cmd.Filter.ExcludeTags, tags...)
 	default:
 		return fmt.Errorf("invalid flag for 'next-image': '%s'", f.Type)
 	}
@@ -71,8 +88,12 @@ func (cmd *NextImageCommand) ValidateSubCommand(sc Command) error {
 
 type NextImageRequestBody struct {
 	Alignment *string  `json:"alignment,omitempty"`
-	Opacity   *float32 `json:"opacity,omitempty"`
+	Opacity   *Opacity `json:"opacity,omitempty"`
 	Stretch   *string  `json:"stretch,omitempty"`
+	// images must have at least one of these tags
+	Tags []string `json:"tags,omitempty"`
+	// images must have none of these tags
+	ExcludeTags []string `json:"exclude_tags,omitempty"`
 }
 
 func (cmd *NextImageCommand) Execute() error {
@@ -90,9 +111,11 @@ func (cmd *NextImageCommand) Execute() error {
 		return err
 	}
 	nextImageArgs := NextImageRequestBody{
-		Alignment: cmd.Alignment,
-		Stretch:   cmd.Stretch,
-		Opacity:   cmd.Opacity,
+		Alignment:   cmd.Alignment,
+		Stretch:     cmd.Stretch,
+		Opacity:     cmd.Opacity,
+		Tags:        cmd.Filter.Tags,
+		ExcludeTags: cmd.Filter.ExcludeTags,
 	}
 	reqBody, err := json.Marshal(nextImageArgs)
 	if err != nil {
@@ -103,6 +126,11 @@ func (cmd *NextImageCommand) Execute() error {
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// e.g. no images match the tags
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
 	return nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+type PauseCommand struct {
+	Port *uint16
+}
+
+func (cmd *PauseCommand) Type() CommandType { return PauseCommandType }
+
+func (r *PauseCommand) String() {
+	fmt.Println("Pause Command:", r.Type())
+}
+
+func (cmd *PauseCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'pause' takes no args. got: '%s'", *val)
+}
+
+func (cmd *PauseCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'pause': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *PauseCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'pause' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+func (cmd *PauseCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/pause", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	fmt.Println("resp:", resp.Status)
+	return nil
+}
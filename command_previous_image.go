@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+type PreviousImageCommand struct {
+	Port *uint16
+}
+
+func (cmd *PreviousImageCommand) Type() CommandType { return PreviousImageCommandType }
+
+func (r *PreviousImageCommand) String() {
+	fmt.Println("Previous Image Command:", r.Type())
+}
+
+func (cmd *PreviousImageCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'previous-image' takes no args. got: '%s'", *val)
+}
+
+func (cmd *PreviousImageCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'previous-image': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *PreviousImageCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'previous-image' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+func (cmd *PreviousImageCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/previous-image", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Post(url, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// e.g. the image is in an archive and cannot be extracted
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	fmt.Println("resp:", resp.Status)
+	return nil
+}
@@ -8,8 +8,8 @@ type RunCommand struct {
 	Alignment *string
 	// path to a custom config file
 	Config   *string
-	Interval *uint16
-	Opacity  *float32
+	Interval *Interval
+	Opacity  *Opacity
 	Port     *uint16
 	Profile  *string
 	Stretch  *string
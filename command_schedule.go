@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type ScheduleCommand struct {
+	// what to do with the schedule. Only "show" for now
+	Action string
+	// path to a custom config file
+	Config *string
+}
+
+func (cmd *ScheduleCommand) Type() CommandType { return ScheduleCommandType }
+
+func (cmd *ScheduleCommand) String() {
+	fmt.Println("Schedule Command:", cmd.Type())
+	fmt.Println("Action:", cmd.Action)
+	if cmd.Config != nil {
+		fmt.Println("Flags:")
+		fmt.Println(" ", ConfigFlag, *cmd.Config)
+	}
+}
+
+func (cmd *ScheduleCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return fmt.Errorf("'schedule' must have an argument. got none")
+	}
+	switch *val {
+	case "show":
+		cmd.Action = *val
+		return nil
+	default:
+		return fmt.Errorf("invalid arg for 'schedule': '%s'. valid args: show", *val)
+	}
+}
+
+func (cmd *ScheduleCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case ConfigFlag:
+		val, err := ValidateConfig(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Config = val
+	default:
+		return fmt.Errorf("invalid flag for 'schedule': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *ScheduleCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'schedule' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+// Prints the rules of the schedule, marking the active ones, and when the
+// active rules change next
+func (cmd *ScheduleCommand) Execute() error {
+	config, _, err := ConfigInit(cmd.Config)
+	if err != nil {
+		return err
+	}
+	now := config.Now()
+	fmt.Print(`timezone: `, Option(config.Timezone).UnwrapOr("Local"),
+		` (now: `, now.Format("2006-01-02 15:04 Mon"), `)
+`)
+	if len(config.Schedule) == 0 {
+		fmt.Println("schedule: none. Every path is used all the time")
+		return nil
+	}
+	schedule := config.ScheduleAt(now)
+	fmt.Println("schedule:")
+	for i, rule := range config.Schedule {
+		active, _ := rule.activeAt(now)
+		marker := " "
+		var when string
+		if active {
+			marker = Decorate("*").Bold().String()
+			if until := rule.activeUntil(now); until.IsZero() {
+				when = "always active"
+			} else {
+				when = fmt.Sprint("active until ", formatUpcoming(now, until))
+			}
+		} else if start := rule.nextStart(now); !start.IsZero() {
+			when = fmt.Sprint("starts ", formatUpcoming(now, start))
+		} else {
+			when = "never starts"
+		}
+		days := "every day"
+		if len(rule.Days) > 0 {
+			days = strings.Join(rule.Days, " ")
+		}
+		fmt.Print(`  `, marker, ` `, rule.NameOrDefault(i), `: `, rule.From, `-`, rule.To, `, `, days, `, `, when, `
+`)
+		if len(rule.Paths) > 0 {
+			fmt.Print(`      paths: `, rule.Paths, `
+`)
+		}
+		if rule.Alignment != nil {
+			fmt.Print(`      alignment: `, *rule.Alignment, `
+`)
+		}
+		if rule.Opacity != nil {
+			fmt.Print(`      opacity: `, rule.Opacity.String(), `
+`)
+		}
+		if rule.Stretch != nil {
+			fmt.Print(`      stretch: `, *rule.Stretch, `
+`)
+		}
+	}
+	fmt.Println("active now:", config.ruleNames(schedule.Rules))
+	fmt.Println("paths now:", func() string {
+		paths := make([]string, 0, len(config.Paths))
+		for i, path := range config.Paths {
+			if schedule.allows(i) {
+				paths = append(paths, path.Path)
+			}
+		}
+		return strings.Join(paths, ", ")
+	}())
+	if next := config.NextScheduleChange(now); !next.IsZero() {
+		fmt.Println("next change:", formatUpcoming(now, next), "->",
+			config.ruleNames(config.ActiveRules(next)))
+	} else {
+		fmt.Println("next change: never")
+	}
+	return nil
+}
+
+// e.g. "2025-01-02 18:00 Thu (in 3h20m)"
+func formatUpcoming(now, t time.Time) string {
+	in := t.Sub(now).Round(time.Minute).String()
+	in = strings.TrimSuffix(in, "0s")
+	if !slices.Contains([]string{"", "0"}, in) {
+		in = "in " + in
+	} else {
+		in = "now"
+	}
+	return fmt.Sprint(t.Format("2006-01-02 15:04 Mon"), " (", in, ")")
+}
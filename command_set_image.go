@@ -4,15 +4,17 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type SetImageCommand struct {
 	Path      string
 	Alignment *string
-	Opacity   *float32
+	Opacity   *Opacity
 	Stretch   *string
 	Port      *uint16
 }
@@ -31,7 +33,7 @@ func (cmd *SetImageCommand) ValidateValue(val *string) error {
 	if err != nil {
 		return fmt.Errorf("Failed to get absolute path of %s: %s", *val, err)
 	}
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+	if _, err := statFile(absPath); err != nil {
 		return fmt.Errorf("%s does not exist: %s", *val, err.Error())
 	}
 	if !IsImageFile(absPath) {
@@ -85,7 +87,7 @@ func (cmd *SetImageCommand) ValidateSubCommand(sc Command) error {
 type SetImageRequestBody struct {
 	Path      string   `json:"path"`
 	Alignment *string  `json:"alignment,omitempty"`
-	Opacity   *float32 `json:"opacity,omitempty"`
+	Opacity   *Opacity `json:"opacity,omitempty"`
 	Stretch   *string  `json:"stretch,omitempty"`
 }
 
@@ -118,6 +120,11 @@ func (cmd *SetImageCommand) Execute() error {
 	if err != nil {
 		return err
 	}
-	resp.Body.Close()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// e.g. the image is in an archive and cannot be extracted
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
 	return nil
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type StatusCommand struct {
+	// print the raw json response of the server instead of the human readable
+	// version
+	Json bool
+	Port *uint16
+}
+
+func (cmd *StatusCommand) Type() CommandType { return StatusCommandType }
+
+func (r *StatusCommand) String() {
+	fmt.Println("Status Command:", r.Type())
+}
+
+func (cmd *StatusCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return nil
+	}
+	return fmt.Errorf("'status' takes no args. got: '%s'", *val)
+}
+
+func (cmd *StatusCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case JsonFlag:
+		if f.Value != nil && *f.Value != "" {
+			return fmt.Errorf("--json takes no args. got: '%s'", *f.Value)
+		}
+		cmd.Json = true
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'status': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *StatusCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'status' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+type StatusResponseBody struct {
+	// empty if the server has not changed the image yet
+	Image     string  `json:"image"`
+	Profile   string  `json:"profile"`
+	Alignment string  `json:"alignment"`
+	Opacity   float32 `json:"opacity"`
+	Stretch   string  `json:"stretch"`
+	Interval  string  `json:"interval"`
+	Port      uint16  `json:"port"`
+	Paused    bool    `json:"paused"`
+	// tags restricting the images used. Empty if none
+	Tags TagFilter `json:"tags"`
+	// nil if paused
+	NextImage *time.Time `json:"next_image,omitempty"`
+}
+
+func (cmd *StatusCommand) Execute() error {
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/status", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status: server responded with %s", resp.Status)
+	}
+	if cmd.Json {
+		_, err = io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+	var status StatusResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("Failed to decode response body: %s", err)
+	}
+	status.Log()
+	return nil
+}
+
+// prints the status in the same format as the config
+func (status *StatusResponseBody) Log() {
+	image := status.Image
+	if image == "" {
+		image = "none yet"
+	}
+	fmt.Print(`image:      `, image, `
+profile:    `, status.Profile, `
+alignment:  `, status.Alignment, `
+opacity:    `, strconv.FormatFloat(float64(status.Opacity), 'f', -1, 32), `
+stretch:    `, status.Stretch, `
+port:       `, status.Port, `
+interval:   `, status.Interval, `
+tags:       `, status.Tags, `
+next image: `, func() string {
+		if status.Paused || status.NextImage == nil {
+			return "paused"
+		}
+		return fmt.Sprint(status.NextImage.Local().Format(time.DateTime),
+			" (in ", time.Until(*status.NextImage).Round(time.Second), ")",
+		)
+	}(), `
+`)
+}
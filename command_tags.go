@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+)
+
+type TagsCommand struct {
+	// what to do with the active tags: show, set, or clear
+	Action string
+	// passed through --tag and --exclude-tag. Only used by "set"
+	Filter TagFilter
+	// print the raw json response of the server instead of the human readable
+	// version
+	Json bool
+	Port *uint16
+}
+
+func (cmd *TagsCommand) Type() CommandType { return TagsCommandType }
+
+func (cmd *TagsCommand) String() {
+	fmt.Println("Tags Command:", cmd.Type())
+	fmt.Println("Action:", cmd.Action)
+}
+
+func (cmd *TagsCommand) ValidateValue(val *string) error {
+	if val == nil || *val == "" {
+		return fmt.Errorf("'tags' must have an argument. got none")
+	}
+	switch *val {
+	case "show", "set", "clear":
+		cmd.Action = *val
+		return nil
+	default:
+		return fmt.Errorf("invalid arg for 'tags': '%s'. valid args: show, set, clear", *val)
+	}
+}
+
+func (cmd *TagsCommand) ValidateFlag(f Flag) error {
+	switch f.Type {
+	case TagFlag:
+		tags, err := ValidateTags(f.Type, f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Filter.Tags = append(cmd.Filter.Tags, tags...)
+	case ExcludeTagFlag:
+		tags, err := ValidateTags(f.Type, f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Filter.ExcludeTags = append(cmd.Filter.ExcludeTags, tags...)
+	case JsonFlag:
+		if f.Value != nil && *f.Value != "" {
+			return fmt.Errorf("--json takes no args. got: '%s'", *f.Value)
+		}
+		cmd.Json = true
+	case PortFlag:
+		val, err := ValidatePort(f.Value)
+		if err != nil {
+			return err
+		}
+		cmd.Port = val
+	default:
+		return fmt.Errorf("invalid flag for 'tags': '%s'", f.Type)
+	}
+	return nil
+}
+
+func (cmd *TagsCommand) ValidateSubCommand(sc Command) error {
+	switch sc.Type() {
+	case NoCommandType:
+		return nil
+	default:
+		return fmt.Errorf("'tags' takes no sub commands. got: '%s'", sc.Type())
+	}
+}
+
+type TagsResponseBody struct {
+	// tags restricting the images used by the server. Empty if none
+	Active TagFilter `json:"active"`
+	// number of images with each tag across all paths
+	Counts map[string]int `json:"counts"`
+}
+
+func (cmd *TagsCommand) Execute() error {
+	if cmd.Action == "set" && cmd.Filter.IsZero() {
+		return fmt.Errorf("'tags set' must have at least one %s or %s", TagFlag, ExcludeTagFlag)
+	}
+	if cmd.Action != "set" && !cmd.Filter.IsZero() {
+		return fmt.Errorf("%s and %s are only valid for 'tags set'", TagFlag, ExcludeTagFlag)
+	}
+	configPath, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	yamlFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read config at %s: %s", shrinkHome(configPath), err)
+	}
+	config := new(Config)
+	err = config.Unmarshal(yamlFile)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/tags", Option(cmd.Port).UnwrapOr(config.PortOrDefault()))
+	var resp *http.Response
+	switch cmd.Action {
+	case "show":
+		resp, err = http.Get(url)
+	default:
+		// an empty filter clears the active tags
+		reqBody, err := json.Marshal(cmd.Filter)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %s", err)
+		}
+		resp, err = http.Post(url, "application/json", bytes.NewReader(reqBody))
+		if err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tags: server responded with %s", resp.Status)
+	}
+	if cmd.Json {
+		_, err = io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+	var tags TagsResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return fmt.Errorf("Failed to decode response body: %s", err)
+	}
+	tags.Log()
+	return nil
+}
+
+// prints the active tags and the number of images with each tag
+func (tags *TagsResponseBody) Log() {
+	fmt.Println("active:", tags.Active)
+	if len(tags.Counts) == 0 {
+		fmt.Println("tags:   none")
+		return
+	}
+	fmt.Println("tags:")
+	for _, tag := range slices.Sorted(maps.Keys(tags.Counts)) {
+		marker := " "
+		if tags.Active.matches([]string{tag}) && len(tags.Active.Tags) > 0 {
+			marker = Decorate("*").Bold().String()
+		}
+		fmt.Printf("  %s %s: %d\n", marker, tag, tags.Counts[tag])
+	}
+}
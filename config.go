@@ -3,29 +3,65 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	DefaultAlignment string  = "center"
-	DefaultInterval  uint16  = 30 * 60
-	DefaultOpacity   float32 = 1.0
-	DefaultPort      uint16  = 9545
-	DefaultProfile   string  = "default"
-	DefaultStretch   string  = "uniformToFill"
+	DefaultAlignment string        = "center"
+	DefaultInterval  time.Duration = 30 * time.Minute
+	DefaultOpacity   float32       = 1.0
+	DefaultPort      uint16        = 9545
+	DefaultProfile   string        = "default"
+	DefaultSelection string        = RandomSelection
+	DefaultOrder     string        = NaturalOrder
+	DefaultWeight    float32       = 1.0
+	DefaultWeighting string        = WeightWeighting
+	DefaultStretch   string        = "uniformToFill"
 )
 
 type Config struct {
-	Interval *uint16      `yaml:"interval,omitempty"`
-	Port     *uint16      `yaml:"port,omitempty"`
-	Profile  *string      `yaml:"profile,omitempty"`
-	Paths    []ImagesPath `yaml:"paths"`
+	Interval *Interval `yaml:"interval,omitempty"`
+	// used for paths that do not set their own opacity. Can be "auto"
+	Opacity *Opacity `yaml:"opacity,omitempty"`
+	// range of opacities "auto" chooses from
+	AutoOpacity *OpacityRange `yaml:"auto_opacity,omitempty"`
+	// width:height of the terminal, which "auto" alignment and stretch
+	// compare the aspect ratio of images to
+	TerminalAspectRatio *string `yaml:"terminal_aspect_ratio,omitempty"`
+	// replaces DefaultLayoutRules
+	AutoLayout []LayoutRule `yaml:"auto_layout,omitempty"`
+	// random delay of up to this much added to every image change
+	Jitter    *Duration `yaml:"jitter,omitempty"`
+	Port      *uint16   `yaml:"port,omitempty"`
+	Profile   *string   `yaml:"profile,omitempty"`
+	Selection *string   `yaml:"selection,omitempty"`
+	Order     *string   `yaml:"order,omitempty"`
+	Weighting *string   `yaml:"weighting,omitempty"`
+	Formats   []string  `yaml:"formats,omitempty"`
+	// images smaller than these or with an aspect ratio outside the range
+	// are skipped
+	MinWidth    *uint32      `yaml:"min_width,omitempty"`
+	MinHeight   *uint32      `yaml:"min_height,omitempty"`
+	AspectRatio *AspectRatio `yaml:"aspect_ratio,omitempty"`
+	// larger images are downscaled to fit into a cached copy, which is what
+	// is set as the background image
+	MaxDimensions *Dimensions `yaml:"max_dimensions,omitempty"`
+	// megabytes of images extracted from archives to keep
+	ArchiveCacheSize *uint32      `yaml:"archive_cache_size,omitempty"`
+	Paths            []ImagesPath `yaml:"paths"`
+	// timezone the schedule is evaluated in, e.g. "Asia/Manila". Local if
+	// not set
+	Timezone *string        `yaml:"timezone,omitempty"`
+	Schedule []ScheduleRule `yaml:"schedule,omitempty"`
 }
 
 func (cfg *Config) String() string {
@@ -38,15 +74,67 @@ func (cfg *Config) String() string {
 		return ret
 	}(), `
     Interval: `, cfg.Interval, `
+    Opacity: `, cfg.Opacity, `
+    AutoOpacity: `, cfg.AutoOpacity, `
+    TerminalAspectRatio: `, cfg.TerminalAspectRatio, `
+    AutoLayout: `, cfg.AutoLayout, `
+    Jitter: `, cfg.Jitter, `
     Port: `, cfg.Port, `
-    Profile: `, cfg.Profile,
+    Profile: `, cfg.Profile, `
+    Selection: `, cfg.Selection, `
+    Order: `, cfg.Order, `
+    Weighting: `, cfg.Weighting, `
+    Formats: `, cfg.Formats, `
+    MinWidth: `, cfg.MinWidth, `
+    MinHeight: `, cfg.MinHeight, `
+    AspectRatio: `, cfg.AspectRatio, `
+    MaxDimensions: `, cfg.MaxDimensions, `
+    ArchiveCacheSize: `, cfg.ArchiveCacheSize, `
+    Timezone: `, cfg.Timezone, `
+    Schedule: `, cfg.Schedule,
 	)
 }
 
 // returns the interval if it is set. otherwise, it returns the default
-// interval (30)
-func (cfg *Config) IntervalOrDefault() uint16 {
-	return Option(cfg.Interval).UnwrapOr(DefaultInterval)
+// interval (30 minutes)
+func (cfg *Config) IntervalOrDefault() Interval {
+	return Option(cfg.Interval).UnwrapOr(Interval{Every: DefaultInterval})
+}
+
+// returns the interval of the first path the image is from if that path sets
+// one. otherwise, the global interval
+func (cfg *Config) IntervalOf(image string) Interval {
+	if image == "" {
+		return cfg.IntervalOrDefault()
+	}
+	for _, path := range cfg.Paths {
+		if path.Contains(image) {
+			return Option(path.Interval).UnwrapOr(cfg.IntervalOrDefault())
+		}
+	}
+	return cfg.IntervalOrDefault()
+}
+
+// returns the opacity if it is set. otherwise, it returns the default
+// opacity (1)
+func (cfg *Config) OpacityOrDefault() Opacity {
+	return Option(cfg.Opacity).UnwrapOr(Opacity(DefaultOpacity))
+}
+
+// Maps the luminance of an image (0 to 1) to the auto_opacity range: the
+// brighter the image, the lower the opacity
+func (cfg *Config) AutoOpacityOf(luminance float64) float32 {
+	autoOpacity := Option(cfg.AutoOpacity).UnwrapOr(OpacityRange{})
+	low := Option(autoOpacity.Min).UnwrapOr(DefaultAutoOpacityMin)
+	high := Option(autoOpacity.Max).UnwrapOr(DefaultAutoOpacityMax)
+	opacity := float64(high) - min(max(luminance, 0), 1)*float64(high-low)
+	// e.g. 0.43 instead of 0.4321 since the difference is not visible
+	return float32(math.Round(opacity*100) / 100)
+}
+
+// returns the jitter if it is set. otherwise, no jitter
+func (cfg *Config) JitterOrDefault() time.Duration {
+	return Option(cfg.Jitter).UnwrapOr(Duration{}).Duration
 }
 
 // returns the port if it is set. otherwise, it returns the default
@@ -61,6 +149,58 @@ func (cfg *Config) ProfileOrDefault() string {
 	return Option(cfg.Profile).UnwrapOr(DefaultProfile)
 }
 
+// returns the selection if it is set. otherwise, it returns the default
+// selection ("random")
+func (cfg *Config) SelectionOrDefault() string {
+	return Option(cfg.Selection).UnwrapOr(DefaultSelection)
+}
+
+// returns the order if it is set. otherwise, it returns the default order
+// ("natural")
+func (cfg *Config) OrderOrDefault() string {
+	return Option(cfg.Order).UnwrapOr(DefaultOrder)
+}
+
+// returns the weighting if it is set. otherwise, it returns the default
+// weighting ("weight")
+func (cfg *Config) WeightingOrDefault() string {
+	return Option(cfg.Weighting).UnwrapOr(DefaultWeighting)
+}
+
+// returns the formats if set. otherwise, it returns every supported format
+func (cfg *Config) FormatsOrDefault() []string {
+	if len(cfg.Formats) == 0 {
+		return SupportedFormats
+	}
+	return cfg.Formats
+}
+
+// returns the formats of the path if set. otherwise, it returns the formats
+// in the config
+func (cfg *Config) FormatsOf(path *ImagesPath) []string {
+	if len(path.Formats) == 0 {
+		return cfg.FormatsOrDefault()
+	}
+	return path.Formats
+}
+
+// Which images under the path are used: the formats, min_width, min_height,
+// and aspect_ratio of the path if set. otherwise, the ones in the config
+func (cfg *Config) FilterOf(path *ImagesPath) ImageFilter {
+	return ImageFilter{
+		Formats:     cfg.FormatsOf(path),
+		MinWidth:    Option(path.MinWidth).Or(cfg.MinWidth).UnwrapOr(0),
+		MinHeight:   Option(path.MinHeight).Or(cfg.MinHeight).UnwrapOr(0),
+		AspectRatio: Option(path.AspectRatio).Or(cfg.AspectRatio).val,
+	}
+}
+
+// returns the order of the path if it is set. otherwise, it returns the order
+// in the config
+func (cfg *Config) OrderOf(path *ImagesPath) string {
+	return Option(path.Order).UnwrapOr(cfg.OrderOrDefault())
+}
+
 // Common config initialization for all commands accepting --config flag.
 //
 // Reads the config file at the given path and validates it.
@@ -96,7 +236,7 @@ func ConfigInit(optConfigPath *string) (*Config, string, error) {
 		for _, err := range errs {
 			fmt.Fprintln(&errMsg, " ", err)
 		}
-		return nil, "", fmt.Errorf(errMsg.String())
+		return nil, "", errors.New(errMsg.String())
 	}
 	return config, configPath, nil
 }
@@ -155,7 +295,7 @@ func (cfg *Config) AddPath(
 	pathToAdd string,
 	cleanPathToAdd string,
 	align *string,
-	opacity *float32,
+	opacity *Opacity,
 	stretch *string,
 ) error {
 	isEditingOptions := align != nil || stretch != nil || opacity != nil
@@ -189,12 +329,13 @@ func (cfg *Config) AddPath(
 					Stretch:   finalStretch,
 				},
 			}
-			cfg.Paths[i] = ImagesPath{
-				Path:      pathToAdd,
-				Alignment: Option(align).Or(path.Alignment).val,
-				Opacity:   Option(opacity).Or(path.Opacity).val,
-				Stretch:   Option(stretch).Or(path.Stretch).val,
-			}
+			// keep the other fields of the path as is
+			updated := path
+			updated.Path = pathToAdd
+			updated.Alignment = Option(align).Or(path.Alignment).val
+			updated.Opacity = Option(opacity).Or(path.Opacity).val
+			updated.Stretch = Option(stretch).Or(path.Stretch).val
+			cfg.Paths[i] = updated
 			break
 		}
 	}
@@ -282,18 +423,18 @@ type configEdits struct {
 
 func (cfg *Config) EditConfig(
 	configPath string,
-	interval *uint16,
+	interval *Interval,
 	port *uint16,
 	profile *string,
 ) error {
 	edits := make([]configEdits, 0)
 	if interval != nil {
-		if cfg.IntervalOrDefault() != *interval {
+		if cfg.IntervalOrDefault().String() != interval.String() {
 			edits = append(edits,
 				configEdits{
 					title: "interval",
-					old:   strconv.FormatUint(uint64(cfg.IntervalOrDefault()), 10),
-					new:   strconv.FormatUint(uint64(*interval), 10),
+					old:   cfg.IntervalOrDefault().String(),
+					new:   interval.String(),
 				},
 			)
 			cfg.Interval = interval
@@ -357,7 +498,7 @@ func (cfg *Config) Validate() []error {
 			)
 			errs = append(errs, errors.New(errStr.String()))
 			errStr.Reset()
-		} else if _, err = os.Stat(absPath); os.IsNotExist(err) {
+		} else if _, err = os.Stat(absPath); os.IsNotExist(err) && path.Feed == nil {
 			fmt.Fprint(&errStr,
 				"path ", i+1,
 				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
@@ -366,6 +507,181 @@ func (cfg *Config) Validate() []error {
 			errs = append(errs, errors.New(errStr.String()))
 			errStr.Reset()
 		}
+		// validate the image, archive, playlist, or feed the path points to
+		kind, err := path.Kind()
+		if err == nil && kind == FeedPathKind {
+			if _, err := ValidateFeed(path.Feed); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " feed",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+			if info, err := os.Stat(absPath); err == nil && !info.IsDir() {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " feed",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "the path of a feed must be a directory to download its images into",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+			if path.Recursive != nil || path.MaxDepth != nil || path.FollowSymlinks != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1,
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "recursive, max_depth, and follow_symlinks do not apply to feeds; images are downloaded into the directory itself",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+			if path.Refresh != nil && path.Refresh.Next(cfg.Now()).IsZero() {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " refresh",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "'", path.Refresh, "' never matches",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		} else if path.Refresh != nil || path.CacheSize != nil {
+			fmt.Fprint(&errStr,
+				"path ", i+1,
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "refresh and cache_size only apply to feeds",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		if path.Feed != nil && path.Exec != nil {
+			fmt.Fprint(&errStr,
+				"path ", i+1,
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "feed and exec cannot both be set",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		if err == nil && kind == ExecPathKind {
+			if info, err := os.Stat(absPath); err == nil && !info.IsDir() {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " exec",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "the path of a command must be the directory to run it in",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+			if path.Timeout != nil && path.Timeout.Duration <= 0 {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " timeout",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "must be greater than 0. got: ", path.Timeout,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		} else if path.Timeout != nil {
+			fmt.Fprint(&errStr,
+				"path ", i+1,
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "timeout only applies to exec",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		if err == nil && kind == ArchivePathKind {
+			if path.Recursive != nil || path.MaxDepth != nil || path.FollowSymlinks != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1,
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "recursive, max_depth, and follow_symlinks do not apply to archives; every image in them is used",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+			if err := ValidateArchive(absPath); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1,
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		} else if err == nil && kind != DirectoryPathKind && kind != FeedPathKind {
+			if path.Recursive != nil || path.MaxDepth != nil || path.FollowSymlinks != nil ||
+				len(path.Include) > 0 || len(path.Exclude) > 0 {
+				fmt.Fprint(&errStr,
+					"path ", i+1,
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "recursive, max_depth, follow_symlinks, include, and exclude only apply to directories",
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		}
+		if err == nil && kind == PlaylistPathKind {
+			absPath, _ := NormalizePath(path.Path)
+			playlist, err := ReadPlaylist(absPath)
+			if err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " playlist",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			} else {
+				for _, err := range playlist.Errors {
+					fmt.Fprint(&errStr,
+						"path ", i+1, " playlist",
+						" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+						leftPad, strings.ReplaceAll(err.Error(), "\n", leftPad),
+						"\n",
+					)
+					errs = append(errs, errors.New(errStr.String()))
+					errStr.Reset()
+				}
+				for _, entry := range playlist.Entries {
+					if !IsImageFile(entry.Image) {
+						fmt.Fprint(&errStr,
+							"path ", i+1, " playlist",
+							" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+							leftPad, "line ", entry.Line, ": not an image file: ", entry.Image,
+							"\n",
+						)
+						errs = append(errs, errors.New(errStr.String()))
+						errStr.Reset()
+					}
+				}
+				if len(playlist.Entries) == 0 && len(playlist.Errors) == 0 {
+					fmt.Fprint(&errStr,
+						"path ", i+1, " playlist",
+						" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+						leftPad, "playlist has no images. If this is meant to be an image, it is not in a supported format",
+						"\n",
+					)
+					errs = append(errs, errors.New(errStr.String()))
+					errStr.Reset()
+				}
+			}
+		}
 		// validate path alignment if set
 		alignment := path.AlignmentOrDefault()
 		if _, err = ValidateAlignment(&alignment); err != nil {
@@ -379,7 +695,7 @@ func (cfg *Config) Validate() []error {
 			errStr.Reset()
 		}
 		// validate path opacity if set
-		opacity := strconv.FormatFloat(float64(path.OpacityOrDefault()), 'f', -1, 32)
+		opacity := path.OpacityOrDefault().String()
 		if _, err = ValidateOpacity(&opacity); err != nil {
 			fmt.Fprint(&errStr,
 				"path ", i+1, " opacity",
@@ -390,6 +706,154 @@ func (cfg *Config) Validate() []error {
 			errs = append(errs, errors.New(errStr.String()))
 			errStr.Reset()
 		}
+		// validate path selection if set
+		selection := path.SelectionOrDefault()
+		if _, err = ValidatePathSelection(&selection); err != nil {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " selection",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, strings.ReplaceAll(err.Error(), "\n", leftPad),
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		// validate path order if set
+		order := cfg.OrderOf(&path)
+		if _, err = ValidateOrder(&order); err != nil {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " order",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, strings.ReplaceAll(err.Error(), "\n", leftPad),
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		// validate path weight if set
+		if weight := path.WeightOrDefault(); weight <= 0 {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " weight",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "must be greater than 0. got: ", weight,
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		// validate path scan options if set
+		if path.MaxDepth != nil && !Option(path.Recursive).UnwrapOr(false) {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " max_depth",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "max_depth only applies when recursive is true",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		if path.FollowSymlinks != nil && !Option(path.Recursive).UnwrapOr(false) {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " follow_symlinks",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "follow_symlinks only applies when recursive is true",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		globs := []struct {
+			field    string
+			patterns []string
+		}{{"include", path.Include}, {"exclude", path.Exclude}}
+		for _, glob := range globs {
+			for _, pattern := range glob.patterns {
+				if err := ValidateGlob(pattern); err != nil {
+					fmt.Fprint(&errStr,
+						"path ", i+1, " ", glob.field,
+						" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+						leftPad, err,
+						"\n",
+					)
+					errs = append(errs, errors.New(errStr.String()))
+					errStr.Reset()
+				}
+			}
+		}
+		// validate path formats if set
+		for _, format := range path.Formats {
+			if _, err := ValidateFormat(&format); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " formats",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, strings.ReplaceAll(err.Error(), "\n", leftPad),
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		}
+		// validate path interval if set. The format is already validated when
+		// unmarshalling
+		if path.Interval != nil && path.Interval.Next(cfg.Now()).IsZero() {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " interval",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "'", path.Interval, "' never matches",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
+		// validate path tags if set
+		for _, tag := range path.Tags {
+			if _, err := ValidateTag(&tag); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " tags",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		}
+		// validate path effects if set
+		for j, effect := range path.Effects {
+			if err := effect.Validate(); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " effects",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, "effect ", j+1, ": ", err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		}
+		// validate path crop if set
+		if path.Crop != nil {
+			if _, err := ValidateCrop(path.Crop); err != nil {
+				fmt.Fprint(&errStr,
+					"path ", i+1, " crop",
+					" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+					leftPad, err,
+					"\n",
+				)
+				errs = append(errs, errors.New(errStr.String()))
+				errStr.Reset()
+			}
+		}
+		if path.Focus != nil && Option(path.Crop).UnwrapOr("") != SmartCrop {
+			fmt.Fprint(&errStr,
+				"path ", i+1, " focus",
+				" (", filepath.Join("..", filepath.Base(path.Path)), ")",
+				leftPad, "focus only applies to crop: smart",
+				"\n",
+			)
+			errs = append(errs, errors.New(errStr.String()))
+			errStr.Reset()
+		}
 		// validate path stretch if set
 		stretch := path.StretchOrDefault()
 		if _, err = ValidateStretch(&stretch); err != nil {
@@ -404,11 +868,25 @@ func (cfg *Config) Validate() []error {
 		}
 	}
 
-	// validate config interval if set
-	interval := strconv.FormatUint(uint64(cfg.IntervalOrDefault()), 10)
-	if _, err := ValidateInterval(&interval); err != nil {
-		errs = append(errs, fmt.Errorf("interval: %s", err))
+	// validate config interval if set. The format is already validated when
+	// unmarshalling
+	if next := cfg.IntervalOrDefault().Next(cfg.Now()); next.IsZero() {
+		errs = append(errs, fmt.Errorf("interval: '%s' never matches", cfg.IntervalOrDefault()))
+	}
+	// validate config jitter if set. The format is already validated when
+	// unmarshalling
+	if cfg.Jitter != nil && cfg.Jitter.Duration < 0 {
+		errs = append(errs, fmt.Errorf("jitter: must be greater than or equal to 0. got: %s", cfg.Jitter.Duration))
+	}
+	// validate config auto_opacity if set. opacity is already validated when
+	// unmarshalling
+	if cfg.AutoOpacity != nil {
+		if err := cfg.AutoOpacity.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("auto_opacity: %s", err))
+		}
 	}
+	// validate config terminal_aspect_ratio and auto_layout if set
+	errs = append(errs, cfg.validateLayout()...)
 	// validate config port if set
 	port := strconv.FormatUint(uint64(cfg.PortOrDefault()), 10)
 	if _, err := ValidatePort(&port); err != nil {
@@ -419,14 +897,96 @@ func (cfg *Config) Validate() []error {
 	if _, err := ValidateProfile(&profile); err != nil {
 		errs = append(errs, fmt.Errorf("profile: %s", err))
 	}
+	// validate config selection if set
+	selection := cfg.SelectionOrDefault()
+	if _, err := ValidateSelection(&selection); err != nil {
+		errs = append(errs, fmt.Errorf("selection: %s", err))
+	}
+	// validate config order if set
+	order := cfg.OrderOrDefault()
+	if _, err := ValidateOrder(&order); err != nil {
+		errs = append(errs, fmt.Errorf("order: %s", err))
+	}
+	// validate config weighting if set
+	weighting := cfg.WeightingOrDefault()
+	if _, err := ValidateWeighting(&weighting); err != nil {
+		errs = append(errs, fmt.Errorf("weighting: %s", err))
+	}
+	// validate config formats if set
+	for _, format := range cfg.Formats {
+		if _, err := ValidateFormat(&format); err != nil {
+			errs = append(errs, fmt.Errorf("formats: %s", err))
+		}
+	}
+	// validate config timezone and schedule if set
+	if _, err := cfg.Location(); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %s", err))
+	}
+	for i, rule := range cfg.Schedule {
+		errs = append(errs, cfg.validateRule(i, rule)...)
+	}
 	return errs
 }
 
 type ImagesPath struct {
 	Path      string   `yaml:"path"`
 	Alignment *string  `yaml:"alignment,omitempty"`
-	Opacity   *float32 `yaml:"opacity,omitempty"`
+	Opacity   *Opacity `yaml:"opacity,omitempty"`
 	Stretch   *string  `yaml:"stretch,omitempty"`
+	// how images under this path are chosen when the global selection is
+	// "random" or "shuffle"
+	Selection *string `yaml:"selection,omitempty"`
+	// overrides the global order for the "sequential" selection
+	Order *string `yaml:"order,omitempty"`
+	// how likely this path is chosen by the "random" selection relative to
+	// the other paths
+	Weight *float32 `yaml:"weight,omitempty"`
+	// walk subdirectories as well
+	Recursive *bool `yaml:"recursive,omitempty"`
+	// levels of subdirectories to walk when recursive. unlimited if not set
+	MaxDepth *uint16 `yaml:"max_depth,omitempty"`
+	// only use images whose name (or path relative to Path) matches any of
+	// these globs
+	Include []string `yaml:"include,omitempty"`
+	// skip images and directories whose name (or path relative to Path)
+	// matches any of these globs
+	Exclude []string `yaml:"exclude,omitempty"`
+	// walk symlinks to directories when recursive
+	FollowSymlinks *bool `yaml:"follow_symlinks,omitempty"`
+	// overrides the global formats
+	Formats []string `yaml:"formats,omitempty"`
+	// overrides the global interval for how long images from this path stay
+	Interval *Interval `yaml:"interval,omitempty"`
+	// tags of every image under this path. Images can have more tags in the
+	// sidecar of their directory. See SidecarName
+	Tags []string `yaml:"tags,omitempty"`
+	// override the global min_width, min_height, and aspect_ratio
+	MinWidth    *uint32      `yaml:"min_width,omitempty"`
+	MinHeight   *uint32      `yaml:"min_height,omitempty"`
+	AspectRatio *AspectRatio `yaml:"aspect_ratio,omitempty"`
+	// applied in order to a cached copy of each image, which is what is set
+	// as the background image. See Processing
+	Effects Effects `yaml:"effects,omitempty"`
+	// crops images to terminal_aspect_ratio before the effects: "center" or
+	// "smart". See CenterCrop and SmartCrop
+	Crop *string `yaml:"crop,omitempty"`
+	// where the "smart" crop keeps images centered on unless their sidecar
+	// sets one. Chosen from each image if not set
+	Focus *FocalPoint `yaml:"focus,omitempty"`
+	// overrides the global max_dimensions
+	MaxDimensions *Dimensions `yaml:"max_dimensions,omitempty"`
+	// URL of a feed of images downloaded into Path, which is then used like
+	// a directory. See RefreshFeed()
+	Feed *string `yaml:"feed,omitempty"`
+	// how often the feed is refreshed. 1h if not set
+	Refresh *Interval `yaml:"refresh,omitempty"`
+	// megabytes of images kept from the feed. 256 if not set
+	CacheSize *uint32 `yaml:"cache_size,omitempty"`
+	// command run in Path whose output lists the images to use, after every
+	// image change. See TbgState.runExecs()
+	Exec *ExecCommand `yaml:"exec,omitempty"`
+	// how long the command may run. 10s if not set
+	Timeout *Duration `yaml:"timeout,omitempty"`
 }
 
 func (path *ImagesPath) String() string {
@@ -435,7 +995,80 @@ func (path *ImagesPath) String() string {
   Stretch: `, Option(path.Stretch).UnwrapOr("not set"), `
   Opacity: `, func() string {
 		if path.Opacity != nil {
-			return strconv.FormatFloat(float64(*path.Opacity), 'f', -1, 32)
+			return path.Opacity.String()
+		}
+		return "not set"
+	}(), `
+  Selection: `, Option(path.Selection).UnwrapOr("not set"), `
+  Order: `, Option(path.Order).UnwrapOr("not set"), `
+  Weight: `, func() string {
+		if path.Weight != nil {
+			return strconv.FormatFloat(float64(*path.Weight), 'f', -1, 32)
+		}
+		return "not set"
+	}(), `
+  Recursive: `, Option(path.Recursive).UnwrapOr(false), `
+  MaxDepth: `, func() string {
+		if path.MaxDepth != nil {
+			return strconv.FormatUint(uint64(*path.MaxDepth), 10)
+		}
+		return "not set"
+	}(), `
+  Include: `, path.Include, `
+  Exclude: `, path.Exclude, `
+  FollowSymlinks: `, Option(path.FollowSymlinks).UnwrapOr(false), `
+  Formats: `, path.Formats, `
+  Interval: `, func() string {
+		if path.Interval != nil {
+			return path.Interval.String()
+		}
+		return "not set"
+	}(), `
+  Tags: `, path.Tags, `
+  MinWidth: `, Option(path.MinWidth).UnwrapOr(0), `
+  MinHeight: `, Option(path.MinHeight).UnwrapOr(0), `
+  AspectRatio: `, func() string {
+		if path.AspectRatio != nil {
+			return path.AspectRatio.String()
+		}
+		return "not set"
+	}(), `
+  Effects: `, path.Effects, `
+  Crop: `, Option(path.Crop).UnwrapOr("not set"), `
+  Focus: `, func() string {
+		if path.Focus != nil {
+			return path.Focus.String()
+		}
+		return "not set"
+	}(), `
+  MaxDimensions: `, func() string {
+		if path.MaxDimensions != nil {
+			return path.MaxDimensions.String()
+		}
+		return "not set"
+	}(), `
+  Feed: `, Option(path.Feed).UnwrapOr("not set"), `
+  Refresh: `, func() string {
+		if path.Refresh != nil {
+			return path.Refresh.String()
+		}
+		return "not set"
+	}(), `
+  CacheSize: `, func() string {
+		if path.CacheSize != nil {
+			return fmt.Sprint(*path.CacheSize, " MB")
+		}
+		return "not set"
+	}(), `
+  Exec: `, func() string {
+		if path.Exec != nil {
+			return path.Exec.String()
+		}
+		return "not set"
+	}(), `
+  Timeout: `, func() string {
+		if path.Timeout != nil {
+			return path.Timeout.String()
 		}
 		return "not set"
 	}(), `
@@ -448,8 +1081,8 @@ func (path *ImagesPath) AlignmentOrDefault() string {
 }
 
 // get opacity if set, otherwise the default value
-func (path *ImagesPath) OpacityOrDefault() float32 {
-	return Option(path.Opacity).UnwrapOr(DefaultOpacity)
+func (path *ImagesPath) OpacityOrDefault() Opacity {
+	return Option(path.Opacity).UnwrapOr(Opacity(DefaultOpacity))
 }
 
 // get stretch if set, otherwise the default value
@@ -457,32 +1090,112 @@ func (path *ImagesPath) StretchOrDefault() string {
 	return Option(path.Stretch).UnwrapOr(DefaultStretch)
 }
 
-// get all images under the directory
-func (path *ImagesPath) Images() ([]string, error) {
+// get selection if set, otherwise "random"
+func (path *ImagesPath) SelectionOrDefault() string {
+	return Option(path.Selection).UnwrapOr(RandomSelection)
+}
+
+// get weight if set, otherwise the default value
+func (path *ImagesPath) WeightOrDefault() float32 {
+	return Option(path.Weight).UnwrapOr(DefaultWeight)
+}
+
+// get all images in the formats under the directory, in the archive, listed in
+// the playlist, or the image itself depending on the kind of path.
+// Subdirectories are only walked if recursive is set. Files already in the
+// index are not opened again unless they changed; the index may be nil
+func (path *ImagesPath) Images(index *ImageIndex, filter ImageFilter) ([]string, error) {
+	scanner, err := path.scan(index, filter)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.images, nil
+}
+
+// same as ImagesPath.Images() but returns the number of images per format as
+// well
+func (path *ImagesPath) ImagesByFormat(index *ImageIndex, filter ImageFilter) ([]string, map[string]int, error) {
+	scanner, err := path.scan(index, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scanner.images, scanner.counts, nil
+}
+
+// Files under the path that were skipped while looking for images and why.
+// Returns the images found as well
+func (path *ImagesPath) Rejected(index *ImageIndex, filter ImageFilter) ([]string, []Rejection, error) {
+	scanner, err := path.scan(index, filter)
+	if scanner == nil {
+		return nil, nil, err
+	}
+	return scanner.images, scanner.rejected, nil
+}
+
+// The scanner is returned even if it found no images so its rejections can
+// still be used
+func (path *ImagesPath) scan(index *ImageIndex, filter ImageFilter) (*scanner, error) {
 	dir, err := NormalizePath(path.Path)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to normalize path %s: %s", path.Path, err)
 	}
-	images := make([]string, 0)
-	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+	// the path is read again since it may have changed since the last scan
+	kind, err := path.kindOf(dir)
+	if path.Feed == nil && path.Exec == nil {
+		scannedPaths.store(dir, kind, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := newScanner(path, dir, index, filter)
+	switch kind {
+	case FeedPathKind:
+		// nothing is downloaded yet, which is not an error since the feed
+		// is refreshed in the background
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			return scanner, nil
+		}
+		if err := scanner.walk(dir, 0); err != nil {
+			return nil, fmt.Errorf("Failed to walk directory %s: %s", dir, err)
+		}
+		return scanner, nil
+	case ExecPathKind:
+		output, err := path.execOutput()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if d.IsDir() && d.Name() != filepath.Base(dir) {
-			return filepath.SkipDir
+		for _, entry := range output.Entries {
+			scanner.file(entry.Image)
 		}
-		if IsImageFile(filepath.Join(dir, d.Name())) {
-			images = append(images, path)
+		// the command may give images the next time it runs
+		return scanner, nil
+	case ImagePathKind:
+		scanner.file(dir)
+	case ArchivePathKind:
+		if err := scanner.archive(dir); err != nil {
+			return nil, fmt.Errorf("Failed to read archive %s: %s", dir, err)
+		}
+	case PlaylistPathKind:
+		playlist, err := ReadPlaylist(dir)
+		if err != nil {
+			return nil, err
+		}
+		scannedPaths.store(dir, kind, playlist)
+		for _, err := range playlist.Errors {
+			slog.Warn("Skipping playlist entry", "playlist", dir, "error", err)
+		}
+		for _, entry := range playlist.Entries {
+			scanner.file(entry.Image)
+		}
+	default:
+		if err := scanner.walk(dir, 0); err != nil {
+			return nil, fmt.Errorf("Failed to walk directory %s: %s", dir, err)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to walk directory %s: %s", dir, err)
 	}
-	if len(images) == 0 {
-		return nil, fmt.Errorf("Found no image files at %s", dir)
+	if len(scanner.images) == 0 {
+		return scanner, fmt.Errorf("Found no image files at %s", dir)
 	}
-	return images, nil
+	return scanner, nil
 }
 
 type ConfigLogger struct{}
@@ -490,7 +1203,7 @@ type ConfigLogger struct{}
 func (cfg *Config) Log(configPath string) ConfigLogger {
 	shrunkConfigPath := shrinkHome(configPath)
 	fmt.Print("## ", shrunkConfigPath, `
-paths:    `, func() string {
+paths:     `, func() string {
 		if len(cfg.Paths) == 0 {
 			return "[]"
 		}
@@ -510,12 +1223,182 @@ paths:    `, func() string {
 				fmt.Fprint(&ret, `
       stretch:`, dir.StretchOrDefault())
 			}
+			if dir.Selection != nil {
+				fmt.Fprint(&ret, `
+      selection: `, dir.SelectionOrDefault())
+			}
+			if dir.Order != nil {
+				fmt.Fprint(&ret, `
+      order: `, *dir.Order)
+			}
+			if dir.Weight != nil {
+				fmt.Fprint(&ret, `
+      weight: `, dir.WeightOrDefault())
+			}
+			if dir.Recursive != nil {
+				fmt.Fprint(&ret, `
+      recursive: `, *dir.Recursive)
+			}
+			if dir.MaxDepth != nil {
+				fmt.Fprint(&ret, `
+      max_depth: `, *dir.MaxDepth)
+			}
+			if len(dir.Include) > 0 {
+				fmt.Fprint(&ret, `
+      include: `, dir.Include)
+			}
+			if len(dir.Exclude) > 0 {
+				fmt.Fprint(&ret, `
+      exclude: `, dir.Exclude)
+			}
+			if dir.FollowSymlinks != nil {
+				fmt.Fprint(&ret, `
+      follow_symlinks: `, *dir.FollowSymlinks)
+			}
+			if len(dir.Formats) > 0 {
+				fmt.Fprint(&ret, `
+      formats: `, dir.Formats)
+			}
+			if dir.Interval != nil {
+				fmt.Fprint(&ret, `
+      interval: `, dir.Interval)
+			}
+			if len(dir.Tags) > 0 {
+				fmt.Fprint(&ret, `
+      tags: `, dir.Tags)
+			}
+			if dir.MinWidth != nil {
+				fmt.Fprint(&ret, `
+      min_width: `, *dir.MinWidth)
+			}
+			if dir.MinHeight != nil {
+				fmt.Fprint(&ret, `
+      min_height: `, *dir.MinHeight)
+			}
+			if dir.AspectRatio != nil {
+				fmt.Fprint(&ret, `
+      aspect_ratio: `, dir.AspectRatio)
+			}
+			if len(dir.Effects) > 0 {
+				fmt.Fprint(&ret, `
+      effects: `, dir.Effects)
+			}
+			if dir.Crop != nil {
+				fmt.Fprint(&ret, `
+      crop: `, *dir.Crop)
+			}
+			if dir.Focus != nil {
+				fmt.Fprint(&ret, `
+      focus: `, dir.Focus)
+			}
+			if dir.MaxDimensions != nil {
+				fmt.Fprint(&ret, `
+      max_dimensions: `, dir.MaxDimensions)
+			}
+			if dir.Feed != nil {
+				fmt.Fprint(&ret, `
+      feed: `, *dir.Feed)
+			}
+			if dir.Refresh != nil {
+				fmt.Fprint(&ret, `
+      refresh: `, dir.Refresh)
+			}
+			if dir.CacheSize != nil {
+				fmt.Fprint(&ret, `
+      cache_size: `, *dir.CacheSize, ` MB`)
+			}
+			if dir.Exec != nil {
+				fmt.Fprint(&ret, `
+      exec: `, dir.Exec)
+			}
+			if dir.Timeout != nil {
+				fmt.Fprint(&ret, `
+      timeout: `, dir.Timeout)
+			}
+		}
+		return ret.String()
+	}(), `
+profile:   `, cfg.ProfileOrDefault(), `
+port:      `, cfg.PortOrDefault(), `
+interval:  `, cfg.IntervalOrDefault(), `
+jitter:    `, cfg.JitterOrDefault(), `
+opacity:   `, cfg.OpacityOrDefault(), `
+auto_opacity: `, Option(cfg.AutoOpacity).UnwrapOr(OpacityRange{}), `
+terminal_aspect_ratio: `, Option(cfg.TerminalAspectRatio).UnwrapOr(DefaultTerminalAspectRatio), `
+auto_layout: `, func() string {
+		var ret strings.Builder
+		for _, rule := range cfg.LayoutRulesOrDefault() {
+			fmt.Fprint(&ret, `
+    - ratio: `, func() string {
+				if rule.Ratio != nil {
+					return rule.Ratio.String()
+				}
+				return "any"
+			}())
+			if rule.Alignment != nil {
+				fmt.Fprint(&ret, `
+      alignment: `, *rule.Alignment)
+			}
+			if rule.Stretch != nil {
+				fmt.Fprint(&ret, `
+      stretch: `, *rule.Stretch)
+			}
+		}
+		return ret.String()
+	}(), `
+selection: `, cfg.SelectionOrDefault(), `
+order:     `, cfg.OrderOrDefault(), `
+weighting: `, cfg.WeightingOrDefault(), `
+formats:   `, cfg.FormatsOrDefault(), `
+min_width: `, Option(cfg.MinWidth).UnwrapOr(0), `
+min_height: `, Option(cfg.MinHeight).UnwrapOr(0), `
+aspect_ratio: `, func() string {
+		if cfg.AspectRatio != nil {
+			return cfg.AspectRatio.String()
+		}
+		return "any"
+	}(), `
+max_dimensions: `, func() string {
+		if cfg.MaxDimensions != nil && !cfg.MaxDimensions.IsZero() {
+			return cfg.MaxDimensions.String()
+		}
+		return "none"
+	}(), `
+archive_cache_size: `, Option(cfg.ArchiveCacheSize).UnwrapOr(DefaultArchiveCacheSize), ` MB
+timezone:  `, Option(cfg.Timezone).UnwrapOr("Local"), `
+schedule:  `, func() string {
+		if len(cfg.Schedule) == 0 {
+			return "[]"
+		}
+		var ret strings.Builder
+		for i, rule := range cfg.Schedule {
+			fmt.Fprint(&ret, `
+    - name: `, rule.NameOrDefault(i), `
+      from: `, rule.From, `
+      to: `, rule.To)
+			if len(rule.Days) > 0 {
+				fmt.Fprint(&ret, `
+      days: `, rule.Days)
+			}
+			if len(rule.Paths) > 0 {
+				fmt.Fprint(&ret, `
+      paths: `, rule.Paths)
+			}
+			if rule.Alignment != nil {
+				fmt.Fprint(&ret, `
+      alignment: `, *rule.Alignment)
+			}
+			if rule.Opacity != nil {
+				fmt.Fprint(&ret, `
+      opacity: `, *rule.Opacity)
+			}
+			if rule.Stretch != nil {
+				fmt.Fprint(&ret, `
+      stretch: `, *rule.Stretch)
+			}
 		}
 		return ret.String()
 	}(), `
-profile:  `, cfg.ProfileOrDefault(), `
-port:     `, cfg.PortOrDefault(), `
-interval: `, cfg.IntervalOrDefault(), `
 `, func() string {
 		var ret strings.Builder
 		if errs := cfg.Validate(); len(errs) > 0 {
@@ -542,7 +1425,7 @@ func (log ConfigLogger) Added(added *ImagesPath, edited *pathEdit) ConfigLogger
 				fmt.Printf("%-5s- alignment: %s\n", "#", *added.Alignment)
 			}
 			if added.Opacity != nil {
-				fmt.Printf("%-5s- opacity: %f\n", "#", *added.Opacity)
+				fmt.Printf("%-5s- opacity: %s\n", "#", *added.Opacity)
 			}
 			if added.Stretch != nil {
 				fmt.Printf("%-5s- stretch: %s\n", "#", *added.Stretch)
@@ -559,9 +1442,9 @@ func (log ConfigLogger) Added(added *ImagesPath, edited *pathEdit) ConfigLogger
 			}
 			if edited.new.Opacity != nil {
 				if edited.old.Opacity != nil {
-					fmt.Printf("%-5s- old opacity: %f\n", "#", *edited.old.Opacity)
+					fmt.Printf("%-5s- old opacity: %s\n", "#", *edited.old.Opacity)
 				}
-				fmt.Printf("%-5s- new opacity: %f\n", "#", *edited.new.Opacity)
+				fmt.Printf("%-5s- new opacity: %s\n", "#", *edited.new.Opacity)
 			}
 			if edited.new.Stretch != nil {
 				if edited.old.Stretch != nil {
@@ -31,18 +31,143 @@ func NewConfigTemplate(path string) *ConfigTemplate {
 paths:
 - path: ~/Pictures
 
-#: - path: a directory that contain images to choose from when changing background image
+#: - path: a directory that contain images to choose from when changing background image.
+#:         can also be a single image, a zip archive of images (every image
+#:         inside is used, and extracted when it is set), or a playlist file
+#:         listing one image per line:
+#:           # comments and empty lines are ignored
+#:           ~/Pictures/sunset.png
+#:           relative/to/playlist.jpg | alignment=right opacity=0.3 stretch=fill
 #:   alignment: (optional) image alignment in Windows Terminal
-#:              valid values: topLeft, top, topRight, left, center, right, bottomLeft, bottom, bottomRight
+#:              valid values: topLeft, top, topRight, left, center, right, bottomLeft, bottom, bottomRight,
+#:              or auto to choose it from the aspect ratio of each image (see auto_layout)
 #:              default: center
 
 #:   opacity:   (optional) image opacity of background images in Windows Terminal
-#:              valid values: 0.0 - 1.0 (inclusive)
-#:              default: 1.0
+#:              valid values: 0.0 - 1.0 (inclusive), or auto to choose it from
+#:              how bright each image is (see auto_opacity)
+#:              default: the global opacity
 
 #:   stretch:   (optional) image stretch in Windows Terminal
-#:              valid values: fill, none, uniform, uniformToFill
+#:              valid values: fill, none, uniform, uniformToFill, or auto (see auto_layout)
 #:              default: uniformToFill
+
+#:   selection: (optional) how images under this path are chosen when the
+#:              global selection is random or shuffle
+#:              valid values: random, sequential
+#:              default: random
+
+#:   order:     (optional) order of images for the sequential selection
+#:              valid values: same as the global order
+#:              default: the global order
+
+#:   weight:    (optional) how likely this path is chosen by the random
+#:              selection relative to the other paths
+#:              valid values: any number greater than 0
+#:              default: 1.0
+
+#:   recursive: (optional) walk subdirectories as well
+#:              valid values: true, false
+#:              default: false
+
+#:   max_depth: (optional) levels of subdirectories to walk when recursive
+#:              valid values: 0 - 65535
+#:              default: unlimited
+
+#:   include:   (optional) only use images matching any of these globs
+#:              globs without a "/" match the file name (e.g. "*.png").
+#:              Otherwise, they match the path relative to path where "**"
+#:              matches any number of directories (e.g. "Anime/**/*.png")
+#:              default: all images
+
+#:   exclude:   (optional) skip images and directories matching any of these
+#:              globs. same format as include. include and exclude apply to
+#:              the images in an archive as well
+#:              default: nothing is skipped
+
+#:   follow_symlinks: (optional) walk symlinked directories when recursive.
+#:              directories already walked are skipped so loops are safe
+#:              valid values: true, false
+#:              default: false
+
+#:   formats:   (optional) image formats to use under this path
+#:              valid values: same as the global formats
+#:              default: the global formats
+
+#:   interval:  (optional) how long images from this path stay before the
+#:              next image change
+#:              valid values: same as the global interval
+#:              default: the global interval
+
+#:   min_width, min_height, aspect_ratio: (optional) override the global
+#:              min_width, min_height, and aspect_ratio
+
+#:   tags:      (optional) tags of every image under this path, used by
+#:              "tbg tags" and "tbg next-image --tag". Images can have more
+#:              tags in a ".tbg.yml" file in their directory:
+#:                sunset.png:
+#:                  tags: [calm, evening]
+#:                  focus: [0.5, 0.3]
+#:              default: no tags
+
+#:   effects:   (optional) applied in order to a copy of each image, which is
+#:              what is set as the background image. The copies are cached
+#:              next to this config and made again when the image or the
+#:              effects change. Run "tbg cache clean" to remove old copies.
+#:              Only png, jpeg, and gif images can be processed
+#:              valid values: a list of
+#:                - darken: 0.0 - 1.0
+#:                - blur: radius in pixels, 0 - 200
+#:                - desaturate: 0.0 - 1.0
+#:                - tint: {color: "#1e1e2e", amount: 0.0 - 1.0}
+#:                - vignette: 0.0 - 1.0
+#:              default: no effects
+
+#:   crop:      (optional) crop a copy of each image to terminal_aspect_ratio
+#:              before the effects so no part of it is cut off by the terminal.
+#:              "center" keeps the middle of the image. "smart" keeps the focus
+#:              of the image in its ".tbg.yml" file, then the focus of this
+#:              path, then the part of the image with the most detail
+#:              valid values: center, smart
+#:              default: images are not cropped
+
+#:   focus:     (optional) focal point of the "smart" crop as [x, y], where
+#:              [0, 0] is the top left corner and [1, 1] the bottom right
+#:              valid values: [0.0 - 1.0, 0.0 - 1.0]
+#:              default: chosen from each image
+
+#:   max_dimensions: (optional) overrides the global max_dimensions. "0x0"
+#:              keeps every image of this path as is
+
+#:   feed:      (optional) http(s) URL of a feed of images to download into
+#:              path, which is created if needed. The feed can be a JSON list
+#:              of image URLs, an RSS or Atom feed with image enclosures, or a
+#:              directory index. Only images already downloaded are used, so
+#:              an unreachable feed never delays an image change
+#:              default: path is not a feed
+
+#:   refresh:   (optional) how often the feed is downloaded again. unchanged
+#:              feeds are not downloaded again (ETag and Last-Modified)
+#:              valid values: same as the global interval
+#:              default: 1h
+
+#:   cache_size: (optional) megabytes of images kept from the feed. images
+#:              are kept in the order of the feed until they do not fit
+#:              default: 256
+
+#:   exec:      (optional) command run in path in the background after every
+#:              image change, as a list (e.g. [python, pick.py]) or a string
+#:              split on spaces. images are chosen from its last output. it prints the images to use: one per line like a
+#:              playlist, or a JSON array of paths or of objects with a
+#:              "path" and optional "alignment", "opacity", and "stretch".
+#:              TBG_PATH, TBG_IMAGE, TBG_TAGS, TBG_EXCLUDE_TAGS, TBG_SCHEDULE,
+#:              TBG_PROFILE, TBG_PORT, and TBG_CONFIG describe the server.
+#:              a command that fails skips the path until it runs again
+#:              default: path is not a command
+
+#:   timeout:   (optional) how long the command may run before it is stopped
+#:              valid values: seconds or a duration, same as jitter
+#:              default: 10s
 #: }}}
 
 #: port {{{
@@ -64,11 +189,173 @@ paths:
 #: }}}
 
 #: interval {{{
-#: time in seconds between each image change
+#: time between each image change. One of:
+#:   seconds:    1800
+#:   a duration: 90m, 2h30m, 1d12h (d is 24 hours)
+#:   a cron expression: "cron: 0 9 * * mon-fri" (minute hour day-of-month
+#:                      month day-of-week), evaluated in the timezone field
 #: default: 1800 (30 minutes)
 
 # interval: 1800
 
+#: }}}
+
+#: jitter {{{
+#: up to this much random time is added to each wait between image changes
+#: so they do not always happen at the same time. Seconds or a duration
+#: default: 0
+
+# jitter: 5m
+
+#: }}}
+
+#: selection {{{
+#: how the next image is chosen
+#:   random:  choose a random path, then a random image under it
+#:   shuffle: show every image across all paths once in a random order
+#:            before repeating any of them
+#:   sequential: show every image of a path in order before moving on to the
+#:               next path
+#: default: random
+
+# selection: random
+
+#: }}}
+
+#: order {{{
+#: order of images for the sequential selection
+#:   name, name-desc:       by file name
+#:   natural, natural-desc: by file name but numbers are compared by value
+#:                          (page2 before page10)
+#:   mtime, mtime-desc:     by modification time, oldest first
+#: default: natural
+
+# order: natural
+
+#: }}}
+
+#: weighting {{{
+#: how the random selection chooses a path
+#:   weight: by the weight of each path. Paths are equally likely by default
+#:   count:  by the number of images under each path times its weight. Every
+#:           image is equally likely by default
+#: default: weight
+
+# weighting: weight
+
+#: }}}
+
+#: formats {{{
+#: image formats to use. Formats are detected from the contents of each file,
+#: not from its extension
+#: valid values: png, jpeg, gif, webp, bmp, ico, tiff, avif, jxl
+#: default: all of them
+
+# formats: [png, jpeg, gif, webp, bmp, ico, tiff, avif, jxl]
+
+#: }}}
+
+#: min_width, min_height, aspect_ratio {{{
+#: images narrower than min_width, shorter than min_height, or with a
+#: width/height ratio outside the aspect_ratio range are skipped. The range is
+#: "min-max" where each bound is a number (1.6) or a ratio (16:10) and either
+#: can be left out (e.g. "16:10-" or "-1"). Dimensions of tiff, avif, and jxl
+#: images are not read so they are never skipped. Run "tbg list --rejected" to
+#: see which images are skipped and why
+#: default: no limits
+
+# min_width: 1280
+# min_height: 720
+# aspect_ratio: "1.3-2.5"
+
+#: }}}
+
+#: opacity, auto_opacity {{{
+#: opacity of paths that do not set their own: 0.0 - 1.0, or auto. auto
+#: computes the average brightness of each image once (cached in index.json)
+#: and maps it to the auto_opacity range: the brightest images get min so text
+#: stays readable, the darkest get max. Formats other than png, jpeg, and gif
+#: get the middle of the range
+#: default: 1.0, and 0.1 - 0.5 for auto_opacity
+
+# opacity: auto
+# auto_opacity:
+#   min: 0.1
+#   max: 0.5
+
+#: }}}
+
+#: terminal_aspect_ratio, auto_layout {{{
+#: an "auto" alignment or stretch is chosen by the first auto_layout rule whose
+#: ratio range contains the aspect ratio of the image divided by
+#: terminal_aspect_ratio. Below 1 means the image is narrower than the
+#: terminal. A rule without a ratio matches every image. Setting auto_layout
+#: replaces the default rules below
+#: default: "16:9", and the rules below
+
+# terminal_aspect_ratio: "16:9"
+# auto_layout:
+#   - ratio: "-0.75"
+#     alignment: right
+#     stretch: uniform
+#   - alignment: center
+#     stretch: uniformToFill
+
+#: }}}
+
+#: max_dimensions {{{
+#: images wider or taller than this are downscaled to fit, keeping their aspect
+#: ratio, into a copy cached next to this config, which is what is set as the
+#: background image. Large images make Windows Terminal slow to redraw. 0 for
+#: either side does not limit it. Only png, jpeg, and gif images can be
+#: downscaled
+#: default: no limit
+
+# max_dimensions: 3840x2160
+
+#: }}}
+
+#: archive_cache_size {{{
+#: megabytes of images extracted from zip archives to keep next to this config.
+#: The least recently used ones are removed first
+#: default: 512
+
+# archive_cache_size: 512
+
+#: }}}
+
+#: schedule {{{
+#: time windows in which only some of the paths are used, and in which the
+#: default alignment, opacity, and stretch are different. Outside of any
+#: window, every path is used
+#: - name:      (optional) shown in logs and "tbg schedule show"
+#:   from:      start of the window, e.g. "18:00"
+#:   to:        end of the window, e.g. "06:00". can be before "from" to cross
+#:              midnight. equal to "from" for the whole day
+#:   days:      (optional) days the window starts on
+#:              valid values: sun, mon, tue, wed, thu, fri, sat
+#:              default: every day
+#:   paths:     (optional) paths to use, written as they are in "paths"
+#:              default: every path
+#:   alignment: (optional) used for paths that do not set their own
+#:   opacity:   (optional) used for paths that do not set their own
+#:   stretch:   (optional) used for paths that do not set their own
+
+# schedule:
+# - name: evening
+#   from: "18:00"
+#   to: "06:00"
+#   paths: [~/Pictures/dark]
+#   opacity: 0.2
+
+#: }}}
+
+#: timezone {{{
+#: timezone the schedule is evaluated in, e.g. "Asia/Manila"
+#: default: the local timezone
+
+# timezone: Asia/Manila
+
 #: }}} `)
 
 	return &ConfigTemplate{
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard 5 field cron expression: minute hour day-of-month month day-of-week
+//
+// Each field can be "*", a number, a range ("1-5"), a list ("1,3,5"), or any
+// of those with a step ("*/15", "9-17/2"). Months and weekdays can be written
+// as names ("jan", "mon-fri"). Sunday is both 0 and 7. Like most crons, if
+// both the day of month and the day of week are restricted (do not match
+// every day), a day matching either is used.
+//
+// The shorthands @hourly, @daily, @weekly, @monthly, and @yearly are allowed
+// as well.
+type Cron struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// whether the day fields match every day, however they are written (e.g.
+	// "*", "*/1", "1-31")
+	domAny bool
+	dowAny bool
+	raw    string
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+var cronMonths = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+func ParseCron(expr string) (*Cron, error) {
+	raw := strings.TrimSpace(expr)
+	fields := strings.Fields(raw)
+	if len(fields) == 1 {
+		if full, ok := cronShorthands[fields[0]]; ok {
+			fields = strings.Fields(full)
+		}
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day-of-month month day-of-week). got %d", len(fields))
+	}
+	cron := &Cron{raw: raw}
+	var err error
+	if cron.minute, err = parseCronField(fields[0], 0, 59, nil, 0); err != nil {
+		return nil, fmt.Errorf("minute: %s", err)
+	}
+	if cron.hour, err = parseCronField(fields[1], 0, 23, nil, 0); err != nil {
+		return nil, fmt.Errorf("hour: %s", err)
+	}
+	if cron.dom, err = parseCronField(fields[2], 1, 31, nil, 0); err != nil {
+		return nil, fmt.Errorf("day-of-month: %s", err)
+	}
+	if cron.month, err = parseCronField(fields[3], 1, 12, cronMonths, 1); err != nil {
+		return nil, fmt.Errorf("month: %s", err)
+	}
+	if cron.dow, err = parseCronField(fields[4], 0, 7, Weekdays, 0); err != nil {
+		return nil, fmt.Errorf("day-of-week: %s", err)
+	}
+	// sunday is both 0 and 7
+	if cron.dow&(1<<7) != 0 {
+		cron.dow |= 1
+	}
+	cron.domAny = cron.dom == 1<<32-2
+	cron.dowAny = cron.dow&(1<<7-1) == 1<<7-1
+	return cron, nil
+}
+
+// Bits of the values matched by the field. names are matched case
+// insensitively, starting at the value offset
+func parseCronField(field string, lo, hi int, names []string, offset int) (uint64, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return i + offset, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value '%s'", s)
+		}
+		if n < lo || n > hi {
+			return 0, fmt.Errorf("'%d' is out of range %d-%d", n, lo, hi)
+		}
+		return n, nil
+	}
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+			step = n
+		}
+		start, end := lo, hi
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = value(from); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 up to the max every 15
+				end = hi
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range '%s'", rangePart)
+			}
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+func (cron *Cron) String() string {
+	return cron.raw
+}
+
+func (cron *Cron) dayMatches(t time.Time) bool {
+	dom := cron.dom&(1<<t.Day()) != 0
+	dow := cron.dow&(1<<int(t.Weekday())) != 0
+	if cron.domAny || cron.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// First time matched by the expression after t, in the location of t. Zero
+// if nothing matches within 5 years (e.g. "0 0 30 2 *").
+//
+// Time moves forward in absolute time so daylight saving time never moves it
+// back: a time skipped when clocks go forward is not matched that day, and a
+// time repeated when clocks go back is only matched once unless the hour is
+// "*"
+func (cron *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(-time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond())).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if cron.month&(1<<int(t.Month())) == 0 {
+			t = later(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !cron.dayMatches(t) {
+			t = later(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if cron.hour&(1<<t.Hour()) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if cron.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		// the wall clock resolves to its first occurrence
+		repeated := !time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Equal(t)
+		if repeated && cron.hour != 1<<24-1 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// next if it is after t. Otherwise, a minute after t. The start of a day or
+// month may not exist when clocks go forward, which resolves to an earlier time
+func later(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Minute)
+}
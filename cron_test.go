@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNextUnrestrictedDays(t *testing.T) {
+	// 2026-03-02 is a monday
+	from := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		// only mondays, since the day of month matches every day
+		{"0 0 */1 * 1", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31 * mon", time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+		// only the 15th, since the day of week matches every day
+		{"0 0 15 * */1", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 0-6", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * 1-7", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// both restricted, so either matches
+		{"0 0 15 * 5", time.Date(2026, 3, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cron.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: Next(%s) = %s, want %s", tt.expr, from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	at := func(s string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.In(loc)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from string
+		want string
+	}{
+		// clocks go forward from 02:00 EST to 03:00 EDT on 2026-03-08
+		{"gap skipped time", "30 2 * * *", "2026-03-08T01:59:30-05:00", "2026-03-09T02:30:00-04:00"},
+		{"gap weekly", "@weekly", "2026-03-08T01:59:30-05:00", "2026-03-15T00:00:00-04:00"},
+		{"gap later today", "0 9 * * 7", "2026-03-08T01:59:30-05:00", "2026-03-08T09:00:00-04:00"},
+		{"gap every 15 minutes", "*/15 * * * *", "2026-03-08T01:59:30-05:00", "2026-03-08T03:00:00-04:00"},
+		// clocks go back from 02:00 EDT to 01:00 EST on 2026-11-01
+		{"overlap first occurrence", "30 1 * * *", "2026-11-01T00:00:00-04:00", "2026-11-01T01:30:00-04:00"},
+		{"overlap not repeated", "30 1 * * *", "2026-11-01T01:45:00-04:00", "2026-11-02T01:30:00-05:00"},
+		{"overlap every 15 minutes", "*/15 * * * *", "2026-11-01T01:50:00-04:00", "2026-11-01T01:00:00-05:00"},
+		{"overlap hourly", "@hourly", "2026-11-01T01:10:00-05:00", "2026-11-01T02:00:00-05:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := at(tt.from)
+			done := make(chan time.Time, 1)
+			go func() { done <- cron.Next(from) }()
+			select {
+			case got := <-done:
+				if !got.Equal(at(tt.want)) {
+					t.Errorf("Next(%s) = %s, want %s", from, got, at(tt.want))
+				}
+				if !got.After(from) {
+					t.Errorf("Next(%s) = %s is not after it", from, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Next(%s) did not return", from)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Values of ImagesPath.Crop. Both crop images to terminal_aspect_ratio so no
+// part of them is cut off by Windows Terminal
+const (
+	// keeps the middle of the image
+	CenterCrop = "center"
+	// keeps the focal point of the image, either set in a sidecar or the
+	// config, or where the image has the most detail
+	SmartCrop = "smart"
+)
+
+func ValidateCrop(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("crop must have a value. got none")
+	}
+	switch *val {
+	case CenterCrop, SmartCrop:
+		return val, nil
+	default:
+		return nil, fmt.Errorf("invalid crop '%s'. valid values: center, smart", *val)
+	}
+}
+
+// Point of an image as fractions of its width and height, written as [x, y]:
+// [0, 0] is the top left corner and [1, 1] is the bottom right corner
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+func (focus FocalPoint) String() string {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	return "[" + format(focus.X) + ", " + format(focus.Y) + "]"
+}
+
+func (focus *FocalPoint) UnmarshalYAML(node *yaml.Node) error {
+	var point []float64
+	if err := node.Decode(&point); err != nil || len(point) != 2 {
+		return fmt.Errorf("line %d: invalid focus: expected [x, y] (e.g. [0.5, 0.3])", node.Line)
+	}
+	for _, f := range point {
+		if f < 0 || f > 1 {
+			return fmt.Errorf("line %d: invalid focus: x and y must be between 0 and 1", node.Line)
+		}
+	}
+	*focus = FocalPoint{X: point[0], Y: point[1]}
+	return nil
+}
+
+func (focus FocalPoint) MarshalYAML() (any, error) {
+	node := new(yaml.Node)
+	if err := node.Encode([]float64{focus.X, focus.Y}); err != nil {
+		return nil, err
+	}
+	// [x, y] instead of a list on separate lines
+	node.Style = yaml.FlowStyle
+	return node, nil
+}
+
+// Crops the image to the ratio around its focal point: the middle for the
+// "center" crop, and the focus or the automatic focal point for the "smart"
+// crop
+func (p Processing) crop(img image.Image) image.Image {
+	focus := FocalPoint{X: 0.5, Y: 0.5}
+	if p.Crop == SmartCrop {
+		if p.Focus != nil {
+			focus = *p.Focus
+		} else {
+			focus = autoFocalPoint(img, p.Ratio)
+		}
+	}
+	rect := cropRect(img.Bounds(), p.Ratio, focus)
+	// every decoder of the standard library returns an image that has this
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(out, out.Rect, img, rect.Min, draw.Src)
+	return out
+}
+
+// Largest rectangle of the ratio inside bounds, centered on the focal point as
+// much as it fits
+func cropRect(bounds image.Rectangle, ratio float64, focus FocalPoint) image.Rectangle {
+	width, height := bounds.Dx(), bounds.Dy()
+	cropWidth, cropHeight := width, height
+	if float64(width)/float64(height) > ratio {
+		cropWidth = max(int(math.Round(float64(height)*ratio)), 1)
+	} else {
+		cropHeight = max(int(math.Round(float64(width)/ratio)), 1)
+	}
+	x := int(math.Round(focus.X*float64(width) - float64(cropWidth)/2))
+	y := int(math.Round(focus.Y*float64(height) - float64(cropHeight)/2))
+	x = min(max(x, 0), width-cropWidth)
+	y = min(max(y, 0), height-cropHeight)
+	return image.Rect(x, y, x+cropWidth, y+cropHeight).Add(bounds.Min)
+}
+
+// Center of the crop with the most edges, measured on a grayscale sample of
+// at most 160 pixels on the longer side. Flat images are cropped in the middle
+func autoFocalPoint(img image.Image, ratio float64) FocalPoint {
+	bounds := img.Bounds()
+	step := max(max(bounds.Dx(), bounds.Dy())/160, 1)
+	width, height := bounds.Dx()/step, bounds.Dy()/step
+	if width < 3 || height < 3 {
+		return FocalPoint{X: 0.5, Y: 0.5}
+	}
+	gray := make([]float64, width*height)
+	for y := range height {
+		for x := range width {
+			r, g, b, _ := img.At(bounds.Min.X+x*step+step/2, bounds.Min.Y+y*step+step/2).RGBA()
+			gray[y*width+x] = (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+		}
+	}
+	// edges of each column and row of the sample
+	columns := make([]float64, width)
+	rows := make([]float64, height)
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			dx := gray[y*width+x+1] - gray[y*width+x-1]
+			dy := gray[(y+1)*width+x] - gray[(y-1)*width+x]
+			edge := math.Abs(dx) + math.Abs(dy)
+			columns[x] += edge
+			rows[y] += edge
+		}
+	}
+	window := cropRect(image.Rect(0, 0, width, height), ratio, FocalPoint{X: 0.5, Y: 0.5})
+	focus := FocalPoint{X: 0.5, Y: 0.5}
+	if window.Dx() < width {
+		focus.X = (float64(bestWindow(columns, window.Dx(), window.Min.X)) + float64(window.Dx())/2) / float64(width)
+	}
+	if window.Dy() < height {
+		focus.Y = (float64(bestWindow(rows, window.Dy(), window.Min.Y)) + float64(window.Dy())/2) / float64(height)
+	}
+	return focus
+}
+
+// Start of the window of the size with the largest sum of values. Only a
+// strictly larger sum moves it away from the start it would have if centered
+func bestWindow(values []float64, size int, centered int) int {
+	sum := func(start int) float64 {
+		total := 0.0
+		for _, v := range values[start : start+size] {
+			total += v
+		}
+		return total
+	}
+	best, bestSum := centered, sum(centered)
+	for start := 0; start+size <= len(values); start++ {
+		if total := sum(start); total > bestSum {
+			best, bestSum = start, total
+		}
+	}
+	return best
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bumped whenever processing changes how derivatives look so old ones are
+// generated again instead of reused
+const DerivativeVersion = 1
+
+// Derivatives are in the same directory as the config (where tbg.log is). Like
+// the index, they are shared by every server
+func CacheDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "cache")
+}
+
+// What is done to an image before it is written to settings.json. The result
+// is a derivative cached in CacheDir()
+type Processing struct {
+	// CenterCrop, SmartCrop, or empty to not crop
+	Crop string
+	// focal point of the smart crop. Chosen from the image if nil
+	Focus *FocalPoint
+	// aspect ratio the image is cropped to
+	Ratio float64
+	// size the image is downscaled to fit after cropping
+	MaxDimensions Dimensions
+	Effects       Effects
+}
+
+// Images from the first path the image is from are processed with the crop,
+// max_dimensions, and effects of that path. The focus of the smart crop is the
+// one in the sidecar of the image, then the one of the path
+func (cfg *Config) ProcessingOf(image string, sidecars sidecarCache) Processing {
+	for _, path := range cfg.Paths {
+		if !path.Contains(image) {
+			continue
+		}
+		processing := Processing{
+			MaxDimensions: Option(path.MaxDimensions).Or(cfg.MaxDimensions).UnwrapOr(Dimensions{}),
+			Effects:       path.Effects,
+		}
+		if path.Crop != nil {
+			processing.Crop = *path.Crop
+			processing.Ratio = cfg.TerminalAspectRatioOrDefault()
+			if processing.Crop == SmartCrop {
+				processing.Focus = Option(sidecars.entryOf(image).Focus).Or(path.Focus).val
+			}
+		}
+		return processing
+	}
+	return Processing{MaxDimensions: Option(cfg.MaxDimensions).UnwrapOr(Dimensions{})}
+}
+
+// whether the image is used as is
+func (p Processing) IsZero() bool {
+	return p.Crop == "" && p.MaxDimensions.IsZero() && len(p.Effects) == 0
+}
+
+// Whether processing an image of width x height would only copy it: it is
+// not cropped, has no effects, and already fits the max dimensions. Images of
+// unknown dimensions (zero) are processed
+func (p Processing) keepsAsIs(width int, height int) bool {
+	if p.IsZero() {
+		return true
+	}
+	if p.Crop != "" || len(p.Effects) > 0 || width == 0 || height == 0 {
+		return false
+	}
+	fitWidth, fitHeight := p.MaxDimensions.fit(width, height)
+	return fitWidth == width && fitHeight == height
+}
+
+// e.g. "crop: smart [0.5, 0.3] to 1.778, max: 3840x2160, effects: darken=0.3"
+func (p Processing) String() string {
+	if p.IsZero() {
+		return "none"
+	}
+	parts := make([]string, 0, 3)
+	if p.Crop != "" {
+		focus := ""
+		if p.Crop == SmartCrop {
+			focus = " auto"
+			if p.Focus != nil {
+				focus = " " + p.Focus.String()
+			}
+		}
+		parts = append(parts, "crop: "+p.Crop+focus+" to "+strconv.FormatFloat(p.Ratio, 'f', 3, 64))
+	}
+	if !p.MaxDimensions.IsZero() {
+		parts = append(parts, "max: "+p.MaxDimensions.String())
+	}
+	if len(p.Effects) > 0 {
+		parts = append(parts, "effects: "+p.Effects.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Crops the image, downscales it, then applies the effects so they are applied
+// to as few pixels as possible
+func (p Processing) Apply(img image.Image) image.Image {
+	if p.Crop != "" {
+		img = p.crop(img)
+	}
+	if !p.MaxDimensions.IsZero() {
+		img = p.downscale(img)
+	}
+	if len(p.Effects) > 0 {
+		img = p.Effects.Apply(img)
+	}
+	return img
+}
+
+// file names of derivatives. See Processing.derivativeName()
+var derivativeFile = regexp.MustCompile(`^[0-9a-f]{32}\.png$`)
+
+// File name of the derivative of the source. It changes when the source file
+// or the processing changes so a stale derivative is never used
+func (p Processing) derivativeName(source string, info fs.FileInfo) string {
+	sum := sha256.Sum256(fmt.Append(nil,
+		DerivativeVersion, "\x00",
+		source, "\x00",
+		info.Size(), "\x00",
+		info.ModTime().UnixNano(), "\x00",
+		p.String(),
+	))
+	return hex.EncodeToString(sum[:16]) + ".png"
+}
+
+// Path of the derivative of the source in cacheDir, generating it unless it
+// is already there. Whether it was already there is returned as well
+func (p Processing) Derive(cacheDir string, source string) (string, bool, error) {
+	info, err := statFile(source)
+	if err != nil {
+		return "", false, err
+	}
+	derived := filepath.Join(cacheDir, p.derivativeName(source, info))
+	if _, err := os.Stat(derived); err == nil {
+		// the modification time is when it was last used
+		now := time.Now()
+		_ = os.Chtimes(derived, now, now)
+		return derived, true, nil
+	}
+	img, err := DecodeImage(source)
+	if err != nil {
+		return "", false, err
+	}
+	out := p.Apply(img)
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", false, fmt.Errorf("Failed to create cache directory: %s", err)
+	}
+	// multiple servers may share the cache so each writes to its own
+	// temporary file before renaming it
+	tmp, err := os.CreateTemp(cacheDir, "derivative_*.png.tmp")
+	if err != nil {
+		return "", false, fmt.Errorf("Failed to write derivative: %s", err)
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	err = encoder.Encode(tmp, out)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by the owner
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("Failed to write derivative: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), derived); err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("Failed to write derivative: %s", err)
+	}
+	return derived, false, nil
+}
+
+// Path of the file written to settings.json for the image: its derivative if
+// it is processed, otherwise the image itself. The image is used as is if the
+// derivative cannot be generated
+func (tbg *TbgState) derivative(image string) string {
+	processing := tbg.Config.ProcessingOf(image, make(sidecarCache))
+	if processing.IsZero() {
+		return image
+	}
+	// most images fit max_dimensions and are not copied if that is all there
+	// is to do
+	width, height := tbg.Index.dimensions(image)
+	if err := tbg.Index.Save(); err != nil {
+		slog.Warn("Failed to save image index", "error", err)
+	}
+	if processing.keepsAsIs(width, height) {
+		return image
+	}
+	start := time.Now()
+	derived, cached, err := processing.Derive(CacheDir(tbg.ConfigPath), image)
+	if err != nil {
+		slog.Warn("Failed to process image, using the original",
+			"image", image,
+			"processing", processing.String(),
+			"error", err,
+		)
+		return image
+	}
+	slog.Info("Processed image",
+		"image", image,
+		"derivative", derived,
+		"processing", processing.String(),
+		"cached", cached,
+		"took", time.Since(start).Round(time.Millisecond).String(),
+	)
+	return derived
+}
+
+// Result of CleanCache()
+type CacheCleanResult struct {
+	Removed int
+	Kept    int
+	// bytes of the removed files
+	Freed int64
+}
+
+// Removes the derivatives in the cache that are not the current derivative of
+// any image under the paths of the config (e.g. the source changed, the
+// processing changed, or the image is gone), and leftover temporary files
+func CleanCache(config *Config, configPath string, index *ImageIndex) (CacheCleanResult, error) {
+	var result CacheCleanResult
+	cacheDir := CacheDir(configPath)
+	entries, err := os.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("Failed to read cache directory: %s", err)
+	}
+	current := make(map[string]struct{})
+	sidecars := make(sidecarCache)
+	for _, path := range config.Paths {
+		images, err := path.Images(index, config.FilterOf(&path))
+		if err != nil {
+			continue
+		}
+		for _, image := range images {
+			processing := config.ProcessingOf(image, sidecars)
+			if processing.keepsAsIs(index.dimensions(image)) {
+				continue
+			}
+			if info, err := statFile(image); err == nil {
+				current[processing.derivativeName(image, info)] = struct{}{}
+			}
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		var stale bool
+		if derivativeFile.MatchString(name) {
+			_, ok := current[name]
+			stale = !ok
+		} else {
+			// may still be written by a running server if it is recent
+			stale = strings.HasSuffix(name, ".tmp") && time.Since(info.ModTime()) > time.Hour
+		}
+		if !stale {
+			if derivativeFile.MatchString(name) {
+				result.Kept++
+			}
+			continue
+		}
+		if err := os.Remove(filepath.Join(cacheDir, name)); err != nil {
+			return result, fmt.Errorf("Failed to remove %s: %s", name, err)
+		}
+		result.Removed++
+		result.Freed += info.Size()
+	}
+	return result, nil
+}
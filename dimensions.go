@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The standard library only reads png, jpeg, and gif. The dimensions of bmp,
+// webp, and ico are in their headers so only image.DecodeConfig is supported
+// for them. The dimensions of tiff, avif, and jxl are not read
+func init() {
+	image.RegisterFormat(BmpFormat, "BM", decodeUnsupported, bmpConfig)
+	image.RegisterFormat(WebpFormat, "RIFF????WEBP", decodeUnsupported, webpConfig)
+	image.RegisterFormat(IcoFormat, "\x00\x00\x01\x00", decodeUnsupported, icoConfig)
+}
+
+var errDimensionsOnly = errors.New("only the dimensions of this format can be read")
+
+func decodeUnsupported(io.Reader) (image.Image, error) {
+	return nil, errDimensionsOnly
+}
+
+// Width and height of the image file at path, which can be of an image in an
+// archive. Zero if the dimensions of its format cannot be read
+func ImageDimensions(path string) (int, int, error) {
+	handle, err := openFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer handle.Close()
+	return readDimensions(handle)
+}
+
+// Dimensions of the image read from r. See ImageDimensions()
+func readDimensions(r io.Reader) (int, int, error) {
+	config, _, err := image.DecodeConfig(bufio.NewReader(r))
+	if errors.Is(err, image.ErrFormat) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// Decodes the image file at path, which can be of an image in an archive. Only
+// formats the standard library can decode are supported: png, jpeg, and gif
+func DecodeImage(path string) (image.Image, error) {
+	handle, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	img, format, err := image.Decode(bufio.NewReader(handle))
+	if errors.Is(err, errDimensionsOnly) {
+		return nil, fmt.Errorf("cannot decode %s images", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode %s: %s", path, err)
+	}
+	return img, nil
+}
+
+func readHeader(r io.Reader, size int) ([]byte, error) {
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("header too short: %s", err)
+	}
+	return header, nil
+}
+
+// file header (14 bytes) then the DIB header. OS/2 headers (12 bytes) have 16
+// bit dimensions. A negative height means the rows are stored top-down
+func bmpConfig(r io.Reader) (image.Config, error) {
+	header, err := readHeader(r, 26)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if binary.LittleEndian.Uint32(header[14:18]) == 12 {
+		return image.Config{
+			Width:  int(binary.LittleEndian.Uint16(header[18:20])),
+			Height: int(binary.LittleEndian.Uint16(header[20:22])),
+		}, nil
+	}
+	width := int32(binary.LittleEndian.Uint32(header[18:22]))
+	height := int32(binary.LittleEndian.Uint32(header[22:26]))
+	return image.Config{Width: int(abs(width)), Height: int(abs(height))}, nil
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// RIFF header (12 bytes) then the first chunk, which is either a lossy (VP8),
+// lossless (VP8L), or extended (VP8X) image
+func webpConfig(r io.Reader) (image.Config, error) {
+	header, err := readHeader(r, 30)
+	if err != nil {
+		return image.Config{}, err
+	}
+	switch string(header[12:16]) {
+	case "VP8 ":
+		// frame tag (3 bytes) and start code (3 bytes) then 14 bit dimensions
+		return image.Config{
+			Width:  int(binary.LittleEndian.Uint16(header[26:28]) & 0x3fff),
+			Height: int(binary.LittleEndian.Uint16(header[28:30]) & 0x3fff),
+		}, nil
+	case "VP8L":
+		// signature (1 byte) then 14 bits of width-1 and 14 bits of height-1
+		bits := binary.LittleEndian.Uint32(header[21:25])
+		return image.Config{
+			Width:  int(bits&0x3fff) + 1,
+			Height: int(bits>>14&0x3fff) + 1,
+		}, nil
+	case "VP8X":
+		// flags (4 bytes) then 24 bits of width-1 and 24 bits of height-1
+		uint24 := func(b []byte) int { return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 }
+		return image.Config{
+			Width:  uint24(header[24:27]) + 1,
+			Height: uint24(header[27:30]) + 1,
+		}, nil
+	default:
+		return image.Config{}, fmt.Errorf("unknown webp chunk '%s'", header[12:16])
+	}
+}
+
+// header (6 bytes) then a 16 byte entry per image. The largest image is used.
+// 0 means 256
+func icoConfig(r io.Reader) (image.Config, error) {
+	header, err := readHeader(r, 6)
+	if err != nil {
+		return image.Config{}, err
+	}
+	count := int(binary.LittleEndian.Uint16(header[4:6]))
+	var config image.Config
+	for range count {
+		entry, err := readHeader(r, 16)
+		if err != nil {
+			return image.Config{}, err
+		}
+		width, height := int(entry[0]), int(entry[1])
+		if width == 0 {
+			width = 256
+		}
+		if height == 0 {
+			height = 256
+		}
+		if width*height > config.Width*config.Height {
+			config.Width, config.Height = width, height
+		}
+	}
+	return config, nil
+}
+
+// Range of width/height ratios, written as "min-max" where each bound is a
+// number (1.6) or a ratio (16:10). Either bound can be left out:
+//
+//	"1.3-2.5"  landscape images that are not too wide
+//	"16:10-"   at least as wide as 16:10
+//	"-1"       portrait and square images
+type AspectRatio struct {
+	// zero means no lower bound
+	Min float64
+	// zero means no upper bound
+	Max float64
+	// as written in the config, to write it back the same way
+	raw string
+}
+
+func ParseAspectRatio(s string) (AspectRatio, error) {
+	raw := strings.TrimSpace(s)
+	from, to, ok := strings.Cut(raw, "-")
+	if !ok {
+		return AspectRatio{}, fmt.Errorf("invalid aspect ratio range '%s': expected min-max (e.g. 1.3-2.5, 16:10-21:9, 1.5-, -1)", s)
+	}
+	ratio := AspectRatio{raw: raw}
+	var err error
+	if ratio.Min, err = parseRatio(from); err != nil {
+		return AspectRatio{}, err
+	}
+	if ratio.Max, err = parseRatio(to); err != nil {
+		return AspectRatio{}, err
+	}
+	if ratio.Min == 0 && ratio.Max == 0 {
+		return AspectRatio{}, fmt.Errorf("invalid aspect ratio range '%s': at least one bound must be set", s)
+	}
+	if ratio.Max != 0 && ratio.Min > ratio.Max {
+		return AspectRatio{}, fmt.Errorf("invalid aspect ratio range '%s': min is greater than max", s)
+	}
+	return ratio, nil
+}
+
+// "1.6" or "16:10". Zero if empty
+func parseRatio(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	invalid := fmt.Errorf("invalid aspect ratio '%s': expected a positive number (1.6) or width:height (16:10)", s)
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		width, err := strconv.ParseFloat(w, 64)
+		if err != nil || width <= 0 {
+			return 0, invalid
+		}
+		height, err := strconv.ParseFloat(h, 64)
+		if err != nil || height <= 0 {
+			return 0, invalid
+		}
+		return width / height, nil
+	}
+	ratio, err := strconv.ParseFloat(s, 64)
+	if err != nil || ratio <= 0 {
+		return 0, invalid
+	}
+	return ratio, nil
+}
+
+func (ratio AspectRatio) contains(r float64) bool {
+	return r >= ratio.Min && (ratio.Max == 0 || r <= ratio.Max)
+}
+
+func (ratio AspectRatio) String() string {
+	if ratio.raw != "" {
+		return ratio.raw
+	}
+	format := func(f float64) string {
+		if f == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return format(ratio.Min) + "-" + format(ratio.Max)
+}
+
+func (ratio *AspectRatio) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := ParseAspectRatio(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	*ratio = parsed
+	return nil
+}
+
+func (ratio AspectRatio) MarshalYAML() (any, error) {
+	return ratio.String(), nil
+}
+
+// Which images are used, besides the include and exclude globs of a path
+type ImageFilter struct {
+	Formats     []string
+	MinWidth    uint32
+	MinHeight   uint32
+	AspectRatio *AspectRatio
+}
+
+// Why an image with the dimensions does not pass the filter. Empty if it
+// does. Images whose dimensions are unknown always pass
+func (filter *ImageFilter) rejectDimensions(width, height int) string {
+	if width == 0 || height == 0 {
+		return ""
+	}
+	if width < int(filter.MinWidth) {
+		return fmt.Sprintf("%dx%d is narrower than min_width %d", width, height, filter.MinWidth)
+	}
+	if height < int(filter.MinHeight) {
+		return fmt.Sprintf("%dx%d is shorter than min_height %d", width, height, filter.MinHeight)
+	}
+	if filter.AspectRatio != nil {
+		ratio := float64(width) / float64(height)
+		if !filter.AspectRatio.contains(ratio) {
+			return fmt.Sprintf("%dx%d has aspect ratio %s, outside aspect_ratio %s",
+				width, height, strconv.FormatFloat(ratio, 'f', 2, 64), filter.AspectRatio)
+		}
+	}
+	return ""
+}
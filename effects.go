@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// A single step of the effects of a path. Exactly one field is set:
+//
+//	effects:
+//	  - darken: 0.3
+//	  - blur: 8
+//	  - tint: {color: "#1e1e2e", amount: 0.2}
+type Effect struct {
+	// 0 keeps the image as is, 1 makes it black
+	Darken *float64 `yaml:"darken,omitempty"`
+	// radius in pixels of the image
+	Blur *float64 `yaml:"blur,omitempty"`
+	// 0 keeps the colors as is, 1 makes the image grayscale
+	Desaturate *float64 `yaml:"desaturate,omitempty"`
+	Tint       *Tint    `yaml:"tint,omitempty"`
+	// how much the corners are darkened. 1 makes them black
+	Vignette *float64 `yaml:"vignette,omitempty"`
+}
+
+// Blends the image towards Color. 0 keeps the image as is, 1 fills it with
+// Color
+type Tint struct {
+	// "#rrggbb" or "#rgb"
+	Color  string  `yaml:"color"`
+	Amount float64 `yaml:"amount"`
+}
+
+// Effects applied in order
+type Effects []Effect
+
+// e.g. "darken=0.3"
+func (effect Effect) String() string {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	switch {
+	case effect.Darken != nil:
+		return "darken=" + format(*effect.Darken)
+	case effect.Blur != nil:
+		return "blur=" + format(*effect.Blur)
+	case effect.Desaturate != nil:
+		return "desaturate=" + format(*effect.Desaturate)
+	case effect.Tint != nil:
+		return "tint=" + effect.Tint.Color + ":" + format(effect.Tint.Amount)
+	case effect.Vignette != nil:
+		return "vignette=" + format(*effect.Vignette)
+	default:
+		return "none"
+	}
+}
+
+// e.g. "darken=0.3, blur=8"
+func (effects Effects) String() string {
+	parts := make([]string, len(effects))
+	for i, effect := range effects {
+		parts[i] = effect.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (effect Effect) Validate() error {
+	set := 0
+	for _, isSet := range []bool{
+		effect.Darken != nil,
+		effect.Blur != nil,
+		effect.Desaturate != nil,
+		effect.Tint != nil,
+		effect.Vignette != nil,
+	} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("must set exactly one of darken, blur, desaturate, tint, vignette. got %d", set)
+	}
+	amount := func(name string, f float64) error {
+		if f < 0 || f > 1 {
+			return fmt.Errorf("%s must be between 0 and 1. got %s", name, strconv.FormatFloat(f, 'f', -1, 64))
+		}
+		return nil
+	}
+	switch {
+	case effect.Darken != nil:
+		return amount("darken", *effect.Darken)
+	case effect.Blur != nil:
+		if *effect.Blur < 0 || *effect.Blur > 200 {
+			return fmt.Errorf("blur must be between 0 and 200. got %s", strconv.FormatFloat(*effect.Blur, 'f', -1, 64))
+		}
+	case effect.Desaturate != nil:
+		return amount("desaturate", *effect.Desaturate)
+	case effect.Tint != nil:
+		if _, err := parseHexColor(effect.Tint.Color); err != nil {
+			return fmt.Errorf("tint color: %s", err)
+		}
+		return amount("tint amount", effect.Tint.Amount)
+	case effect.Vignette != nil:
+		return amount("vignette", *effect.Vignette)
+	}
+	return nil
+}
+
+// "#rrggbb" or "#rgb"
+func parseHexColor(s string) ([3]float64, error) {
+	hex, ok := strings.CutPrefix(strings.TrimSpace(s), "#")
+	if ok && len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if !ok || len(hex) != 6 {
+		return [3]float64{}, fmt.Errorf("invalid color '%s': expected #rrggbb or #rgb", s)
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]float64{}, fmt.Errorf("invalid color '%s': expected #rrggbb or #rgb", s)
+	}
+	return [3]float64{float64(rgb >> 16 & 0xff), float64(rgb >> 8 & 0xff), float64(rgb & 0xff)}, nil
+}
+
+// Applies the effects in order to a copy of the image
+func (effects Effects) Apply(src image.Image) *image.NRGBA {
+	bounds := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Rect, src, bounds.Min, draw.Src)
+	for _, effect := range effects {
+		effect.apply(img)
+	}
+	return img
+}
+
+func (effect Effect) apply(img *image.NRGBA) {
+	switch {
+	case effect.Darken != nil:
+		amount := *effect.Darken
+		mapPixels(img, func(_, _ int, rgb [3]float64) [3]float64 {
+			for i := range rgb {
+				rgb[i] *= 1 - amount
+			}
+			return rgb
+		})
+	case effect.Blur != nil:
+		boxBlur(img, int(*effect.Blur+0.5))
+	case effect.Desaturate != nil:
+		amount := *effect.Desaturate
+		mapPixels(img, func(_, _ int, rgb [3]float64) [3]float64 {
+			luma := 0.2126*rgb[0] + 0.7152*rgb[1] + 0.0722*rgb[2]
+			for i := range rgb {
+				rgb[i] += (luma - rgb[i]) * amount
+			}
+			return rgb
+		})
+	case effect.Tint != nil:
+		color, _ := parseHexColor(effect.Tint.Color)
+		amount := effect.Tint.Amount
+		mapPixels(img, func(_, _ int, rgb [3]float64) [3]float64 {
+			for i := range rgb {
+				rgb[i] += (color[i] - rgb[i]) * amount
+			}
+			return rgb
+		})
+	case effect.Vignette != nil:
+		amount := *effect.Vignette
+		cx, cy := float64(img.Rect.Dx())/2, float64(img.Rect.Dy())/2
+		mapPixels(img, func(x, y int, rgb [3]float64) [3]float64 {
+			// 0 at the center, 1 at the corners
+			dx, dy := (float64(x)+0.5-cx)/cx, (float64(y)+0.5-cy)/cy
+			distance := (dx*dx + dy*dy) / 2
+			for i := range rgb {
+				rgb[i] *= 1 - amount*distance*distance
+			}
+			return rgb
+		})
+	}
+}
+
+// Replaces the color of every pixel, keeping its alpha
+func mapPixels(img *image.NRGBA, f func(x, y int, rgb [3]float64) [3]float64) {
+	for y := range img.Rect.Dy() {
+		row := img.Pix[y*img.Stride:]
+		for x := range img.Rect.Dx() {
+			px := row[x*4 : x*4+3]
+			rgb := f(x, y, [3]float64{float64(px[0]), float64(px[1]), float64(px[2])})
+			for i := range px {
+				px[i] = uint8(min(max(rgb[i]+0.5, 0), 255))
+			}
+		}
+	}
+}
+
+// Three passes of a box blur in each direction, which is close to a gaussian
+// blur
+func boxBlur(img *image.NRGBA, radius int) {
+	if radius <= 0 {
+		return
+	}
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	tmp := make([]uint8, len(img.Pix))
+	for range 3 {
+		// rows into tmp, then the columns of tmp back into the image
+		boxBlurLines(img.Pix, tmp, width, height, 4, img.Stride, radius)
+		boxBlurLines(tmp, img.Pix, height, width, img.Stride, 4, radius)
+	}
+}
+
+// Blurs count lines of n pixels each. step is the distance between pixels of
+// a line and next the distance between lines. Pixels past the edges repeat
+// the edge pixel
+func boxBlurLines(src, dst []uint8, n, count, step, next, radius int) {
+	size := 2*radius + 1
+	for line := range count {
+		base := line * next
+		at := func(i, c int) int {
+			return int(src[base+min(max(i, 0), n-1)*step+c])
+		}
+		for c := range 4 {
+			sum := 0
+			for i := -radius; i <= radius; i++ {
+				sum += at(i, c)
+			}
+			for i := range n {
+				dst[base+i*step+c] = uint8((sum + radius) / size)
+				sum += at(i+radius+1, c) - at(i-radius, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// An exec path runs a command to get its images. The command is run in the
+// directory at ImagesPath.Path in the background when the server starts and
+// after every image change (see TbgState.runExecs()). Images are chosen from
+// its last output, so an image change never waits on it and the path has no
+// images until the command first finishes. Its output is either:
+//
+//  1. one image per line, in the format of a playlist (see ReadPlaylist())
+//  2. a JSON array of image paths, or of objects with a "path" and optional
+//     "alignment", "opacity", and "stretch"
+//
+// Relative paths are resolved against the directory. A command that fails or
+// takes longer than ImagesPath.Timeout skips the path instead of stopping the
+// server.
+
+// How long a command may run when ImagesPath.Timeout is not set
+const DefaultExecTimeout = 10 * time.Second
+
+// Output of a command past this is ignored
+const maxExecOutput = 1 << 20
+
+// Returned when no image is found while a path has a command that may give
+// images the next time it runs. Like ErrNoTaggedImages, this does not stop
+// the server
+var ErrNoExecImages = errors.New("No images from the commands of the paths")
+
+// A command and its arguments, written in the config as a list
+// ([python, ~/scripts/pick.py]) or as a string split on spaces
+// ("python ~/scripts/pick.py"). The list is needed for arguments with spaces
+type ExecCommand []string
+
+func (command *ExecCommand) UnmarshalYAML(node *yaml.Node) error {
+	var args []string
+	if node.Kind == yaml.ScalarNode {
+		var raw string
+		if err := node.Decode(&raw); err != nil {
+			return err
+		}
+		args = strings.Fields(raw)
+	} else if err := node.Decode(&args); err != nil {
+		return fmt.Errorf("line %d: invalid exec: expected a command (e.g. [python, pick.py])", node.Line)
+	}
+	if len(args) == 0 || args[0] == "" {
+		return fmt.Errorf("line %d: exec must have a command. got none", node.Line)
+	}
+	*command = args
+	return nil
+}
+
+// Arguments with spaces are quoted
+func (command ExecCommand) String() string {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		if strings.ContainsAny(arg, " \t\"") {
+			arg = strconv.Quote(arg)
+		}
+		args[i] = arg
+	}
+	return strings.Join(args, " ")
+}
+
+// Returned when the command of a path fails. The path is skipped when
+// choosing an image
+type ExecError struct {
+	Command ExecCommand
+	Err     error
+}
+
+func (err *ExecError) Error() string {
+	return fmt.Sprintf("Command '%s' failed: %s", err.Command, err.Err)
+}
+
+func (err *ExecError) Unwrap() error {
+	return err.Err
+}
+
+// returns the timeout of the command if set. otherwise, the default timeout
+// (10s)
+func (path *ImagesPath) TimeoutOrDefault() time.Duration {
+	return Option(path.Timeout).UnwrapOr(Duration{Duration: DefaultExecTimeout}).Duration
+}
+
+// Runs the command of the path with the environment variables passed by the
+// server (see TbgState.execEnv()) and reads the images from its output. The
+// result is kept for ImagesPath.execOutput(), ImagesPath.PropsOf(), and
+// ImagesPath.Contains()
+func (path *ImagesPath) runExec(env []string) (*Playlist, error) {
+	dir, err := NormalizePath(path.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to normalize path %s: %s", path.Path, err)
+	}
+	output, err := path.exec(dir, env)
+	execOutputs.store(dir, *path.Exec, output, err)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range output.Errors {
+		slog.Warn("Skipping command output entry", "command", output.Path, "error", err)
+	}
+	return output, nil
+}
+
+func (path *ImagesPath) exec(dir string, env []string) (*Playlist, error) {
+	args := make([]string, len(*path.Exec))
+	for i, arg := range *path.Exec {
+		args[i] = expandEnv(arg)
+	}
+	timeout := path.TimeoutOrDefault()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "TBG_PATH="+filepath.FromSlash(dir))
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr limitedBuffer
+	stdout.limit = maxExecOutput
+	stderr.limit = 4 << 10
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// children of the command may keep its output open after it is killed
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, &ExecError{Command: *path.Exec, Err: fmt.Errorf("timed out after %s", timeout)}
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %s", err, lastLine(msg))
+		}
+		return nil, &ExecError{Command: *path.Exec, Err: err}
+	}
+	output, err := parseExecOutput(dir, stdout.Bytes())
+	if err != nil {
+		return nil, &ExecError{Command: *path.Exec, Err: err}
+	}
+	output.Path = path.Exec.String()
+	return output, nil
+}
+
+// Images in the output of a command, as a playlist whose line numbers are
+// the lines of the output or the items of the JSON array
+func parseExecOutput(dir string, stdout []byte) (*Playlist, error) {
+	output := &Playlist{}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(stdout, []byte("\ufeff")))
+	if !bytes.HasPrefix(trimmed, []byte("[")) {
+		for i, text := range strings.Split(string(trimmed), "\n") {
+			text = strings.TrimSpace(text)
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			entry, err := parsePlaylistLine(dir, text)
+			if err != nil {
+				output.Errors = append(output.Errors, fmt.Errorf("line %d: %s", i+1, err))
+				continue
+			}
+			entry.Line = i + 1
+			output.Entries = append(output.Entries, entry)
+		}
+		return output, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON output: %s", err)
+	}
+	for i, item := range items {
+		entry, err := parseExecItem(dir, item)
+		if err != nil {
+			output.Errors = append(output.Errors, fmt.Errorf("item %d: %s", i+1, err))
+			continue
+		}
+		entry.Line = i + 1
+		output.Entries = append(output.Entries, entry)
+	}
+	return output, nil
+}
+
+// "path/to/image.png" or
+// {"path": "path/to/image.png", "alignment": "right", "opacity": 0.5, "stretch": "fill"}
+func parseExecItem(dir string, item json.RawMessage) (PlaylistEntry, error) {
+	var entry PlaylistEntry
+	var object struct {
+		Path      string          `json:"path"`
+		Alignment *string         `json:"alignment"`
+		Opacity   json.RawMessage `json:"opacity"`
+		Stretch   *string         `json:"stretch"`
+	}
+	if err := json.Unmarshal(item, &object.Path); err != nil {
+		if err := json.Unmarshal(item, &object); err != nil {
+			return entry, fmt.Errorf("expected an image path or an object with a path")
+		}
+	}
+	if object.Path == "" {
+		return entry, fmt.Errorf("missing image path")
+	}
+	image := expandEnv(object.Path)
+	if !filepath.IsAbs(image) {
+		image = filepath.Join(dir, image)
+	}
+	entry.Image = filepath.ToSlash(filepath.Clean(image))
+	var err error
+	if object.Alignment != nil {
+		if entry.Props.Alignment, err = ValidateAlignment(object.Alignment); err != nil {
+			return entry, err
+		}
+	}
+	if len(object.Opacity) > 0 && string(object.Opacity) != "null" {
+		// a number, or a string such as "auto"
+		opacity := strings.Trim(string(object.Opacity), `"`)
+		if entry.Props.Opacity, err = ValidateOpacity(&opacity); err != nil {
+			return entry, err
+		}
+	}
+	if object.Stretch != nil {
+		if entry.Props.Stretch, err = ValidateStretch(object.Stretch); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// Last result of the command of each exec path keyed by its directory and
+// command, so images are chosen and the properties of an image are found
+// without running the command again
+type execOutputCache struct {
+	mu      sync.Mutex
+	results map[string]execResult
+	// commands running in the background. See TbgState.runExecs()
+	running map[string]struct{}
+}
+
+type execResult struct {
+	output *Playlist
+	err    error
+}
+
+var execOutputs = &execOutputCache{
+	results: make(map[string]execResult),
+	running: make(map[string]struct{}),
+}
+
+func execKey(dir string, command ExecCommand) string {
+	return dir + "\x00" + strings.Join(command, "\x00")
+}
+
+func (cache *execOutputCache) store(dir string, command ExecCommand, output *Playlist, err error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.results[execKey(dir, command)] = execResult{output: output, err: err}
+}
+
+// false if the command has not run yet
+func (cache *execOutputCache) load(dir string, command ExecCommand) (execResult, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	result, ok := cache.results[execKey(dir, command)]
+	return result, ok
+}
+
+// Marks the command as running. false if it already is
+func (cache *execOutputCache) start(dir string, command ExecCommand) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if _, ok := cache.running[execKey(dir, command)]; ok {
+		return false
+	}
+	cache.running[execKey(dir, command)] = struct{}{}
+	return true
+}
+
+func (cache *execOutputCache) finish(dir string, command ExecCommand) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.running, execKey(dir, command))
+}
+
+// Images of the last time the command of the path ran, or why it failed.
+// ErrNoExecImages if it has not run yet. The command is never run here
+func (path *ImagesPath) execOutput() (*Playlist, error) {
+	dir, err := NormalizePath(path.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to normalize path %s: %s", path.Path, err)
+	}
+	result, ok := execOutputs.load(dir, *path.Exec)
+	if !ok {
+		return nil, ErrNoExecImages
+	}
+	return result.output, result.err
+}
+
+// Last output of the command of the path. nil if it has not run yet or failed
+func (path *ImagesPath) lastExecOutput() *Playlist {
+	dir, err := NormalizePath(path.Path)
+	if err != nil {
+		return nil
+	}
+	result, _ := execOutputs.load(dir, *path.Exec)
+	return result.output
+}
+
+// whether any path runs a command
+func (cfg *Config) HasExecs() bool {
+	for _, path := range cfg.Paths {
+		if path.Exec != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Environment variables describing the server, passed to the commands of exec
+// paths after an image change:
+//
+//	TBG_CONFIG         path of the config
+//	TBG_PORT           port of the server
+//	TBG_PROFILE        profile whose background image is changed
+//	TBG_IMAGE          current image. Empty if none yet
+//	TBG_TAGS           active tags, comma separated
+//	TBG_EXCLUDE_TAGS   active excluded tags, comma separated
+//	TBG_SCHEDULE       names of the active schedule rules, comma separated
+//
+// Every command gets TBG_PATH as well: the directory it runs in
+func (tbg *TbgState) execEnv(filter TagFilter) []string {
+	rules := make([]string, len(tbg.Schedule.Rules))
+	for i, rule := range tbg.Schedule.Rules {
+		rules[i] = tbg.Config.Schedule[rule].NameOrDefault(rule)
+	}
+	return []string{
+		"TBG_CONFIG=" + tbg.ConfigPath,
+		"TBG_PORT=" + strconv.FormatUint(uint64(tbg.Config.PortOrDefault()), 10),
+		"TBG_PROFILE=" + tbg.Config.ProfileOrDefault(),
+		"TBG_IMAGE=" + filepath.FromSlash(tbg.CurrentImage),
+		"TBG_TAGS=" + strings.Join(filter.Tags, ","),
+		"TBG_EXCLUDE_TAGS=" + strings.Join(filter.ExcludeTags, ","),
+		"TBG_SCHEDULE=" + strings.Join(rules, ","),
+	}
+}
+
+// Runs the commands of the exec paths in the background with the state of
+// the server, so their images are ready the next time images are chosen. A
+// command still running from the last time is not run again
+func (tbg *TbgState) runExecs(filter TagFilter) {
+	if !tbg.Config.HasExecs() {
+		return
+	}
+	env := tbg.execEnv(filter)
+	for _, path := range tbg.Config.Paths {
+		if path.Exec == nil {
+			continue
+		}
+		dir, err := NormalizePath(path.Path)
+		if err != nil || !execOutputs.start(dir, *path.Exec) {
+			continue
+		}
+		go func() {
+			defer execOutputs.finish(dir, *path.Exec)
+			path.runExec(env)
+		}()
+	}
+}
+
+// Keeps the first limit bytes written to it, discarding the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
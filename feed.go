@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A feed path downloads the images listed at ImagesPath.Feed into the
+// directory at ImagesPath.Path, which is then used like any other directory.
+// The feed is refreshed in the background on its own schedule (see
+// ImagesPath.Refresh) so images are only ever chosen from the ones already
+// downloaded, and a feed that cannot be reached never holds up an image
+// change. The feed can be:
+//
+//  1. a JSON array of image URLs, or of objects with a "url"
+//  2. an RSS or Atom feed, using the images in its enclosures
+//  3. a directory index (an HTML page), using the images it links to
+//
+// Relative URLs are resolved against the URL of the feed.
+
+// Name of the file in the directory of a feed path recording what was
+// downloaded from the feed. See FeedManifest
+const FeedManifestName = ".tbg-feed.json"
+
+// Images are downloaded to temporary files starting with this before being
+// renamed so a partial download is never used
+const feedDownloadPrefix = ".tbg-feed-"
+
+// How often a feed is refreshed when ImagesPath.Refresh is not set
+const DefaultFeedRefresh = time.Hour
+
+// Megabytes of images kept from a feed when ImagesPath.CacheSize is not set
+const DefaultFeedCacheSize uint32 = 256
+
+// Longest a feed or one of its images may take to download
+const feedTimeout = 5 * time.Minute
+
+// Returned when no image is found while a feed may still download some. Like
+// ErrNoTaggedImages, this does not stop the server
+var ErrNoFeedImages = errors.New("No images downloaded from the feeds yet")
+
+// Extensions of the images linked to by a directory index, or listed in an
+// RSS or Atom feed without a type
+var feedImageExtensions = map[string]string{
+	".png": PngFormat, ".jpg": JpegFormat, ".jpeg": JpegFormat,
+	".gif": GifFormat, ".webp": WebpFormat, ".bmp": BmpFormat,
+	".ico": IcoFormat, ".tif": TiffFormat, ".tiff": TiffFormat,
+	".avif": AvifFormat, ".jxl": JxlFormat,
+}
+
+// whether the file in the directory of a feed path is used by tbg to keep
+// track of the feed rather than an image
+func isFeedFile(name string) bool {
+	return name == FeedManifestName || strings.HasPrefix(name, feedDownloadPrefix)
+}
+
+func ValidateFeed(val *string) (*string, error) {
+	if val == nil || *val == "" {
+		return nil, fmt.Errorf("feed must have a value. got none")
+	}
+	u, err := url.Parse(*val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid feed '%s': expected an http or https URL", *val)
+	}
+	return val, nil
+}
+
+// What was downloaded from a feed, saved as FeedManifestName in the directory
+// of the feed path
+type FeedManifest struct {
+	Feed string `json:"feed"`
+	// validators of the last response, sent back so an unchanged feed is
+	// not downloaded again
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// when the feed was last refreshed, even if it did not change
+	Refreshed time.Time `json:"refreshed"`
+	// image URLs listed by the feed, in order
+	Items []string `json:"items"`
+	// file name of each downloaded image keyed by its URL. Only these files
+	// are ever removed from the directory
+	Files map[string]string `json:"files"`
+	// why images were not downloaded keyed by their URL. These are tried
+	// again once the feed changes
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Reads the manifest in the directory. Empty if there is none yet
+func ReadFeedManifest(dir string) (*FeedManifest, error) {
+	manifest := &FeedManifest{Files: make(map[string]string), Failed: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(dir, FeedManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", filepath.Join(dir, FeedManifestName), err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", filepath.Join(dir, FeedManifestName), err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]string)
+	}
+	if manifest.Failed == nil {
+		manifest.Failed = make(map[string]string)
+	}
+	return manifest, nil
+}
+
+func (manifest *FeedManifest) Save(dir string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to marshal feed manifest: %s", err)
+	}
+	tmp, err := os.CreateTemp(dir, feedDownloadPrefix+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("Failed to save feed manifest: %s", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temporary files are only readable by the owner
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, FeedManifestName))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Failed to save feed manifest: %s", err)
+	}
+	return nil
+}
+
+// Image URLs listed in a feed, in order and without duplicates. The format
+// is detected from the content rather than trusting the server
+func ParseFeed(body []byte, base *url.URL) ([]string, error) {
+	var raw []string
+	var err error
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\ufeff")))
+	head := strings.ToLower(string(trimmed[:min(len(trimmed), 1024)]))
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		raw, err = parseJSONFeed(trimmed)
+	case strings.Contains(head, "<rss") || strings.Contains(head, "<feed") || strings.Contains(head, "<rdf"):
+		raw, err = parseXMLFeed(trimmed)
+	case strings.Contains(head, "<"):
+		raw = parseDirectoryIndex(trimmed)
+	default:
+		err = errors.New("expected a JSON array of URLs, an RSS or Atom feed, or a directory index")
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := make([]string, 0, len(raw))
+	seen := make(map[string]struct{}, len(raw))
+	for _, item := range raw {
+		ref, err := url.Parse(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			continue
+		}
+		resolved.Fragment = ""
+		if _, ok := seen[resolved.String()]; ok {
+			continue
+		}
+		seen[resolved.String()] = struct{}{}
+		items = append(items, resolved.String())
+	}
+	return items, nil
+}
+
+// ["https://example.com/a.png", {"url": "b.jpg"}]
+func parseJSONFeed(body []byte) ([]string, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, fmt.Errorf("invalid JSON feed: %s", err)
+	}
+	items := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		var item string
+		if err := json.Unmarshal(entry, &item); err == nil {
+			items = append(items, item)
+			continue
+		}
+		var object struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal(entry, &object); err != nil || object.URL == "" {
+			return nil, fmt.Errorf("invalid JSON feed: item %d: expected a URL or an object with a url", i+1)
+		}
+		items = append(items, object.URL)
+	}
+	return items, nil
+}
+
+// Enclosures of an RSS feed (<enclosure url="..." type="image/png"/>) or an
+// Atom feed (<link rel="enclosure" href="..."/>), and Media RSS content
+// (<media:content url="..."/>) that are images
+func parseXMLFeed(body []byte) ([]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	// feeds are not always strict
+	decoder.Strict = false
+	decoder.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	items := make([]string, 0)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSS or Atom feed: %s", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		attrs := make(map[string]string, len(start.Attr))
+		for _, attr := range start.Attr {
+			attrs[attr.Name.Local] = attr.Value
+		}
+		var link string
+		switch start.Name.Local {
+		case "enclosure":
+			link = attrs["url"]
+		case "content":
+			link = attrs["url"]
+			if attrs["medium"] == "image" {
+				attrs["type"] = "image/"
+			}
+		case "link":
+			if attrs["rel"] == "enclosure" {
+				link = attrs["href"]
+			}
+		}
+		if link == "" {
+			continue
+		}
+		if strings.HasPrefix(attrs["type"], "image/") || (attrs["type"] == "" && hasImageExtension(link)) {
+			items = append(items, link)
+		}
+	}
+}
+
+var hrefRegex = regexp.MustCompile(`(?i)href\s*=\s*["']([^"']+)["']`)
+
+// Links to images in an HTML page, e.g. the index of a directory served by
+// a web server
+func parseDirectoryIndex(body []byte) []string {
+	items := make([]string, 0)
+	for _, match := range hrefRegex.FindAllSubmatch(body, -1) {
+		if link := string(match[1]); hasImageExtension(link) {
+			items = append(items, link)
+		}
+	}
+	return items
+}
+
+// whether the path of the URL ends with the extension of an image
+func hasImageExtension(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	_, ok := feedImageExtensions[strings.ToLower(path.Ext(u.Path))]
+	return ok
+}
+
+// Summary of a refresh, logged by the server
+type FeedRefresh struct {
+	// whether the feed changed since the last refresh
+	Changed bool
+	// images listed in the feed
+	Items int
+	// images kept from the feed, including the ones just downloaded
+	Kept       int
+	Downloaded int
+	Removed    int
+	Failed     int
+}
+
+// Fetches the feed into dir unless it has not changed, then downloads the
+// images it lists in order until cacheSize bytes are used. Images no longer
+// listed, or that no longer fit, are removed, except keep (e.g. the current
+// background image) which is removed by a later refresh. Images that fail to
+// download because of the network are tried again on the next refresh
+func RefreshFeed(client *http.Client, dir string, feed string, cacheSize int64, keep string) (FeedRefresh, error) {
+	var result FeedRefresh
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return result, fmt.Errorf("Failed to create directory %s: %s", dir, err)
+	}
+	removeStaleDownloads(dir)
+	manifest, err := ReadFeedManifest(dir)
+	if err != nil {
+		return result, err
+	}
+	if manifest.Feed != feed {
+		// downloaded images of the old feed are removed below since none are
+		// listed anymore
+		*manifest = FeedManifest{Feed: feed, Files: manifest.Files, Failed: make(map[string]string)}
+	}
+	req, err := http.NewRequest(http.MethodGet, feed, nil)
+	if err != nil {
+		return result, fmt.Errorf("Invalid feed %s: %s", feed, err)
+	}
+	req.Header.Set("User-Agent", "tbg/"+TbgVersion)
+	if manifest.ETag != "" {
+		req.Header.Set("If-None-Match", manifest.ETag)
+	}
+	if manifest.LastModified != "" {
+		req.Header.Set("If-Modified-Since", manifest.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("Failed to fetch feed: %s", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return result, fmt.Errorf("Failed to fetch feed: %s", err)
+		}
+		items, err := ParseFeed(body, resp.Request.URL)
+		if err != nil {
+			return result, fmt.Errorf("Failed to parse feed: %s", err)
+		}
+		result.Changed = true
+		manifest.Items = items
+		manifest.ETag = resp.Header.Get("ETag")
+		manifest.LastModified = resp.Header.Get("Last-Modified")
+		clear(manifest.Failed)
+	default:
+		return result, fmt.Errorf("Failed to fetch feed: %s", resp.Status)
+	}
+	manifest.Refreshed = time.Now()
+	result.Items = len(manifest.Items)
+
+	var used int64
+	kept := make(map[string]struct{}, len(manifest.Items))
+	for _, item := range manifest.Items {
+		if _, failed := manifest.Failed[item]; failed {
+			continue
+		}
+		if name, ok := manifest.Files[item]; ok {
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err == nil {
+				if used+info.Size() > cacheSize {
+					break
+				}
+				used += info.Size()
+				kept[item] = struct{}{}
+				continue
+			}
+			// removed by the user, so it is downloaded again
+			delete(manifest.Files, item)
+		}
+		name, size, err := downloadFeedImage(client, dir, item, cacheSize-used)
+		if errors.Is(err, errFeedCacheFull) {
+			if used == 0 {
+				manifest.Failed[item] = err.Error()
+				result.Failed++
+				continue
+			}
+			break
+		}
+		var permanent *feedImageError
+		if errors.As(err, &permanent) {
+			manifest.Failed[item] = err.Error()
+			result.Failed++
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to download image from feed", "feed", feed, "image", item, "error", err)
+			result.Failed++
+			continue
+		}
+		manifest.Files[item] = name
+		used += size
+		kept[item] = struct{}{}
+		result.Downloaded++
+	}
+	keep = filepath.Clean(filepath.FromSlash(keep))
+	for item, name := range manifest.Files {
+		if _, ok := kept[item]; ok || filepath.Join(dir, name) == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to remove image from feed", "feed", feed, "image", name, "error", err)
+			continue
+		}
+		delete(manifest.Files, item)
+		result.Removed++
+	}
+	result.Kept = len(kept)
+	return result, manifest.Save(dir)
+}
+
+// Returned when an image does not fit in what is left of the cache
+var errFeedCacheFull = errors.New("larger than what is left of cache_size")
+
+// An image that will not download no matter how many times it is tried, e.g.
+// because it is not an image or does not exist
+type feedImageError struct {
+	msg string
+}
+
+func (err *feedImageError) Error() string {
+	return err.msg
+}
+
+// Downloads the image at the URL into dir unless it is larger than limit
+// bytes, returning its file name and size
+func downloadFeedImage(client *http.Client, dir string, image string, limit int64) (string, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, image, nil)
+	if err != nil {
+		return "", 0, &feedImageError{msg: err.Error()}
+	}
+	req.Header.Set("User-Agent", "tbg/"+TbgVersion)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected response: %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return "", 0, &feedImageError{msg: err.Error()}
+		}
+		return "", 0, err
+	}
+	if resp.ContentLength > limit {
+		return "", 0, errFeedCacheFull
+	}
+	tmp, err := os.CreateTemp(dir, feedDownloadPrefix+"*.tmp")
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, limit+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > limit {
+		err = errFeedCacheFull
+	}
+	var format string
+	if err == nil {
+		if format = ImageFormat(tmp.Name()); format == "" {
+			err = &feedImageError{msg: "not an image"}
+		}
+	}
+	name := feedFileName(image, format)
+	if err == nil {
+		// temporary files are only readable by the owner
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return name, size, nil
+}
+
+var unsafeFileNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Readable and unique file name of the image at the URL, e.g.
+// "3f2a9c1e_sunset.jpg", with the extension of its format if it has none
+func feedFileName(image string, format string) string {
+	sum := sha256.Sum256([]byte(image))
+	base := "image"
+	if u, err := url.Parse(image); err == nil {
+		if name, err := url.PathUnescape(path.Base(u.Path)); err == nil && name != "/" && name != "." {
+			base = name
+		}
+	}
+	base = strings.Trim(unsafeFileNameRegex.ReplaceAllString(base, "_"), "._")
+	ext := strings.ToLower(path.Ext(base))
+	if feedImageExtensions[ext] != format {
+		if format == JpegFormat {
+			base += ".jpg"
+		} else {
+			base += "." + format
+		}
+	}
+	// long names are cut from the start so the extension is kept
+	if len(base) > 80 {
+		base = base[len(base)-80:]
+	}
+	return hex.EncodeToString(sum[:4]) + "_" + base
+}
+
+// Removes temporary files left by a refresh that was interrupted. Recent
+// ones may still be written by another server using the same directory
+func removeStaleDownloads(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), feedDownloadPrefix) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > time.Hour {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// returns the refresh interval of the feed if set. otherwise, the default
+// interval (1h)
+func (path *ImagesPath) RefreshOrDefault() Interval {
+	return Option(path.Refresh).UnwrapOr(Interval{Every: DefaultFeedRefresh})
+}
+
+// returns the cache size of the feed in bytes if set. otherwise, the default
+// size (256 MB)
+func (path *ImagesPath) CacheSizeOrDefault() int64 {
+	return int64(Option(path.CacheSize).UnwrapOr(DefaultFeedCacheSize)) << 20
+}
+
+// whether any path is a feed
+func (cfg *Config) HasFeeds() bool {
+	for _, path := range cfg.Paths {
+		if path.Feed != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Refreshes the feed of the path every time its refresh interval passes for
+// as long as the server runs. The first refresh waits for the interval to
+// pass since the last one saved in the manifest so restarting the server does
+// not download the feed again. Image changes never wait on this
+func (tbg *TbgState) feedRefresher(path ImagesPath) {
+	dir, err := NormalizePath(path.Path)
+	if err != nil {
+		slog.Warn("Failed to refresh feed", "path", path.Path, "error", err)
+		return
+	}
+	client := &http.Client{Timeout: feedTimeout}
+	refresh := path.RefreshOrDefault()
+	var last time.Time
+	if manifest, err := ReadFeedManifest(dir); err == nil && manifest.Feed == *path.Feed {
+		last = manifest.Refreshed
+	}
+	for {
+		if !last.IsZero() {
+			next := refresh.Next(last.In(tbg.Config.Now().Location()))
+			if next.IsZero() {
+				slog.Warn("Stopped refreshing feed", "path", path.Path, "refresh", refresh.String())
+				return
+			}
+			time.Sleep(time.Until(next))
+		}
+		start := time.Now()
+		last = start
+		result, err := RefreshFeed(client, dir, *path.Feed, path.CacheSizeOrDefault(), tbg.currentImage())
+		if err != nil {
+			slog.Warn("Failed to refresh feed",
+				"path", path.Path,
+				"feed", *path.Feed,
+				"error", err,
+			)
+			continue
+		}
+		slog.Info("Refreshed feed",
+			"path", path.Path,
+			"feed", *path.Feed,
+			"changed", result.Changed,
+			"items", result.Items,
+			"kept", result.Kept,
+			"downloaded", result.Downloaded,
+			"removed", result.Removed,
+			"failed", result.Failed,
+			"took", time.Since(start).Round(time.Millisecond).String(),
+		)
+	}
+}
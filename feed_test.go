@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a 1x1 PNG padded to size bytes
+func fakePng(size int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		panic(err)
+	}
+	return append(buf.Bytes(), make([]byte, max(size-buf.Len(), 0))...)
+}
+
+// Serves the feed at /feed and the images at /<name>, counting the requests
+// for each
+type feedServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	feed     string
+	images   map[string][]byte
+	requests map[string]int
+	// sent with the feed and checked against the conditional headers
+	etag         string
+	lastModified string
+}
+
+func newFeedServer(t *testing.T, images map[string][]byte) *feedServer {
+	t.Helper()
+	s := &feedServer{images: images, requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *feedServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[r.URL.Path]++
+	if r.URL.Path == "/feed" {
+		if s.etag != "" {
+			if r.Header.Get("If-None-Match") == s.etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", s.etag)
+		}
+		if s.lastModified != "" {
+			if r.Header.Get("If-Modified-Since") == s.lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Last-Modified", s.lastModified)
+		}
+		fmt.Fprint(w, s.feed)
+		return
+	}
+	image, ok := s.images[r.URL.Path[1:]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(image)
+}
+
+func (s *feedServer) requestsOf(p string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[p]
+}
+
+// file names in dir, without the manifest
+func downloadedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !isFeedFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestParseFeed(t *testing.T) {
+	base, _ := url.Parse("https://example.com/images/feed")
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "json",
+			body: `["https://example.com/a.png", {"url": "b.jpg"}, "a.png#fragment", "ftp://example.com/c.png"]`,
+			want: []string{"https://example.com/a.png", "https://example.com/images/b.jpg", "https://example.com/images/a.png"},
+		},
+		{
+			name: "rss",
+			body: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/"><channel>
+<item><enclosure url="https://example.com/a.png" type="image/png"/></item>
+<item><enclosure url="https://example.com/song.mp3" type="audio/mpeg"/></item>
+<item><enclosure url="/b.jpg"/></item>
+<item><media:content url="https://example.com/c" medium="image"/></item>
+</channel></rss>`,
+			want: []string{"https://example.com/a.png", "https://example.com/b.jpg", "https://example.com/c"},
+		},
+		{
+			name: "atom",
+			body: `<feed xmlns="http://www.w3.org/2005/Atom">
+<entry><link rel="alternate" href="https://example.com/post.png"/><link rel="enclosure" href="a.webp"/></entry>
+</feed>`,
+			want: []string{"https://example.com/images/a.webp"},
+		},
+		{
+			name: "directory index",
+			body: `<html><body><a href="../">../</a><a href="a.png">a.png</a><a HREF='b.JPG'>b.JPG</a><a href="notes.txt">notes.txt</a></body></html>`,
+			want: []string{"https://example.com/images/a.png", "https://example.com/images/b.JPG"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFeed([]byte(tt.body), base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ParseFeed([]byte("not a feed"), base); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestRefreshFeedFormats(t *testing.T) {
+	images := map[string][]byte{"a.png": fakePng(100), "b.png": fakePng(100)}
+	feeds := map[string]string{
+		"json":            `["a.png", {"url": "b.png"}]`,
+		"rss":             `<rss><channel><item><enclosure url="a.png" type="image/png"/></item><item><enclosure url="b.png"/></item></channel></rss>`,
+		"atom":            `<feed><entry><link rel="enclosure" href="a.png"/></entry><entry><link rel="enclosure" href="b.png"/></entry></feed>`,
+		"directory index": `<pre><a href="a.png">a.png</a> <a href="b.png">b.png</a></pre>`,
+	}
+	for name, feed := range feeds {
+		t.Run(name, func(t *testing.T) {
+			server := newFeedServer(t, images)
+			server.feed = feed
+			dir := t.TempDir()
+			result, err := RefreshFeed(server.Client(), dir, server.URL+"/feed", 1<<20, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Items != 2 || result.Downloaded != 2 || result.Kept != 2 {
+				t.Errorf("got %+v, want 2 items downloaded and kept", result)
+			}
+			if files := downloadedFiles(t, dir); len(files) != 2 {
+				t.Errorf("got files %v, want 2", files)
+			}
+		})
+	}
+}
+
+func TestRefreshFeedNotModified(t *testing.T) {
+	tests := []struct {
+		name         string
+		etag         string
+		lastModified string
+	}{
+		{name: "If-None-Match", etag: `"v1"`},
+		{name: "If-Modified-Since", lastModified: "Mon, 02 Jan 2006 15:04:05 GMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFeedServer(t, map[string][]byte{"a.png": fakePng(100)})
+			server.feed = `["a.png"]`
+			server.etag = tt.etag
+			server.lastModified = tt.lastModified
+			dir := t.TempDir()
+			feed := server.URL + "/feed"
+			if _, err := RefreshFeed(server.Client(), dir, feed, 1<<20, ""); err != nil {
+				t.Fatal(err)
+			}
+			// a changed body proves it is not downloaded again
+			server.feed = `["b.png"]`
+			result, err := RefreshFeed(server.Client(), dir, feed, 1<<20, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Changed || result.Downloaded != 0 || result.Kept != 1 {
+				t.Errorf("got %+v, want the unchanged feed and its image kept", result)
+			}
+			if n := server.requestsOf("/feed"); n != 2 {
+				t.Errorf("feed requested %d times, want 2", n)
+			}
+			if n := server.requestsOf("/a.png"); n != 1 {
+				t.Errorf("image downloaded %d times, want 1", n)
+			}
+			if n := server.requestsOf("/b.png"); n != 0 {
+				t.Errorf("image of the old feed body downloaded %d times, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRefreshFeedCacheSize(t *testing.T) {
+	server := newFeedServer(t, map[string][]byte{
+		"a.png":   fakePng(400),
+		"b.png":   fakePng(400),
+		"c.png":   fakePng(400),
+		"big.png": fakePng(2000),
+	})
+	server.feed = `["big.png", "a.png", "b.png", "c.png"]`
+	dir := t.TempDir()
+	feed := server.URL + "/feed"
+	const cacheSize = 1000
+
+	used := func() int64 {
+		var total int64
+		for _, name := range downloadedFiles(t, dir) {
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += info.Size()
+		}
+		return total
+	}
+
+	result, err := RefreshFeed(server.Client(), dir, feed, cacheSize, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// big.png never fits, then a.png and b.png fill the cache
+	if result.Kept != 2 || result.Failed != 1 {
+		t.Errorf("got %+v, want 2 kept and 1 failed", result)
+	}
+	if n := used(); n > cacheSize {
+		t.Errorf("cache uses %d bytes, more than %d", n, cacheSize)
+	}
+
+	// a new image at the top of the feed evicts the last one kept
+	server.mu.Lock()
+	server.images["d.png"] = fakePng(400)
+	server.feed = `["d.png", "a.png", "b.png", "c.png"]`
+	server.mu.Unlock()
+	result, err = RefreshFeed(server.Client(), dir, feed, cacheSize, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kept != 2 || result.Downloaded != 1 || result.Removed != 1 {
+		t.Errorf("got %+v, want 2 kept, 1 downloaded, and 1 removed", result)
+	}
+	if n := used(); n > cacheSize {
+		t.Errorf("cache uses %d bytes, more than %d", n, cacheSize)
+	}
+	manifest, err := ReadFeedManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, image := range []string{"d.png", "a.png"} {
+		if _, ok := manifest.Files[server.URL+"/"+image]; !ok {
+			t.Errorf("%s was not kept", image)
+		}
+	}
+}
+
+// The current background image is not removed when it leaves the feed
+func TestRefreshFeedKeep(t *testing.T) {
+	server := newFeedServer(t, map[string][]byte{"a.png": fakePng(100), "b.png": fakePng(100)})
+	server.feed = `["a.png"]`
+	dir := t.TempDir()
+	feed := server.URL + "/feed"
+	if _, err := RefreshFeed(server.Client(), dir, feed, 1<<20, ""); err != nil {
+		t.Fatal(err)
+	}
+	files := downloadedFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("got files %v, want 1", files)
+	}
+	current := filepath.ToSlash(filepath.Join(dir, files[0]))
+
+	server.mu.Lock()
+	server.feed = `["b.png"]`
+	server.mu.Unlock()
+	result, err := RefreshFeed(server.Client(), dir, feed, 1<<20, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Removed != 0 {
+		t.Errorf("got %+v, want nothing removed", result)
+	}
+	if _, err := os.Stat(filepath.FromSlash(current)); err != nil {
+		t.Errorf("current image removed: %s", err)
+	}
+
+	// once it is no longer the current image
+	result, err = RefreshFeed(server.Client(), dir, feed, 1<<20, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Removed != 1 {
+		t.Errorf("got %+v, want the old image removed", result)
+	}
+}
+
+// Images already downloaded are still chosen while the feed cannot be
+// reached, and an image change never waits on a refresh
+func TestFeedUnreachable(t *testing.T) {
+	server := newFeedServer(t, map[string][]byte{"a.png": fakePng(100)})
+	server.feed = `["a.png"]`
+	dir := t.TempDir()
+	feed := server.URL + "/feed"
+	if _, err := RefreshFeed(server.Client(), dir, feed, 1<<20, ""); err != nil {
+		t.Fatal(err)
+	}
+	client := server.Client()
+	server.Close()
+
+	if _, err := RefreshFeed(client, dir, feed, 1<<20, ""); err == nil {
+		t.Fatal("expected an error refreshing an unreachable feed")
+	}
+	if files := downloadedFiles(t, dir); len(files) != 1 {
+		t.Fatalf("got files %v, want the image downloaded before", files)
+	}
+
+	// a feed that accepts the connection but never answers
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		RefreshFeed(hanging.Client(), dir, hanging.URL+"/feed", 1<<20, "")
+	}()
+	// the refresh must be done before the directory is removed
+	defer func() {
+		close(release)
+		<-refreshed
+	}()
+
+	tbg := &TbgState{
+		Config:  &Config{Paths: []ImagesPath{{Path: dir, Feed: &feed}}},
+		Index:   NewImageIndex(filepath.Join(t.TempDir(), "index.json")),
+		Scanned: make([][]string, 1),
+	}
+	chosen := make(chan error, 1)
+	go func() {
+		_, image, err := tbg.weightedImage(TagFilter{})
+		if err == nil && filepath.Dir(filepath.FromSlash(image)) != dir {
+			err = fmt.Errorf("chose %s outside of %s", image, dir)
+		}
+		chosen <- err
+	}()
+	select {
+	case err := <-chosen:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("choosing an image waited on the feed")
+	}
+}
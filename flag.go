@@ -10,11 +10,15 @@ const (
 	NoFlag FlagType = iota
 	AlignmentFlag
 	ConfigFlag
+	ExcludeTagFlag
 	IntervalFlag
+	JsonFlag
 	OpacityFlag
 	PortFlag
 	ProfileFlag
+	RejectedFlag
 	StretchFlag
+	TagFlag
 )
 
 func (f FlagType) String() string {
@@ -23,8 +27,12 @@ func (f FlagType) String() string {
 		return "--alignment"
 	case ConfigFlag:
 		return "--config"
+	case ExcludeTagFlag:
+		return "--exclude-tag"
 	case IntervalFlag:
 		return "--interval"
+	case JsonFlag:
+		return "--json"
 	case NoFlag:
 		return "none"
 	case OpacityFlag:
@@ -33,8 +41,12 @@ func (f FlagType) String() string {
 		return "--port"
 	case ProfileFlag:
 		return "--profile"
+	case RejectedFlag:
+		return "--rejected"
 	case StretchFlag:
 		return "--stretch"
+	case TagFlag:
+		return "--tag"
 	default:
 		return "unknown"
 	}
@@ -51,16 +63,24 @@ func ToFlag(s string) (*Flag, error) {
 		return &Flag{Type: AlignmentFlag}, nil
 	case "--config", "-c":
 		return &Flag{Type: ConfigFlag}, nil
+	case "--exclude-tag", "-x":
+		return &Flag{Type: ExcludeTagFlag}, nil
 	case "--interval", "-i":
 		return &Flag{Type: IntervalFlag}, nil
+	case "--json", "-j":
+		return &Flag{Type: JsonFlag}, nil
 	case "--opacity", "-o":
 		return &Flag{Type: OpacityFlag}, nil
 	case "--port", "-P":
 		return &Flag{Type: PortFlag}, nil
 	case "--profile", "-p":
 		return &Flag{Type: ProfileFlag}, nil
+	case "--rejected", "-r":
+		return &Flag{Type: RejectedFlag}, nil
 	case "--stretch", "-s":
 		return &Flag{Type: StretchFlag}, nil
+	case "--tag", "-t":
+		return &Flag{Type: TagFlag}, nil
 	default:
 		return nil, fmt.Errorf("unknown flag: %s", s)
 	}
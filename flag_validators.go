@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"time"
 )
 
 func ValidateAlignment(val *string) (*string, error) {
@@ -11,11 +13,11 @@ func ValidateAlignment(val *string) (*string, error) {
 		return nil, fmt.Errorf("--interval must have an argument. got none")
 	}
 	switch *val {
-	case "topLeft", "top", "topRight", "left", "center", "right", "bottomLeft", "bottom", "bottomRight":
+	case "topLeft", "top", "topRight", "left", "center", "right", "bottomLeft", "bottom", "bottomRight", AutoLayout:
 		return val, nil
 	default:
 		return nil, fmt.Errorf(`invalid arg '%s' for --alignment: unknown alignment
-[topLeft top topRight left center right bottomLeft bottom bottomRight]`, *val)
+[topLeft top topRight left center right bottomLeft bottom bottomRight auto]`, *val)
 	}
 }
 
@@ -34,40 +36,29 @@ func ValidateConfig(val *string) (*string, error) {
 	return &absPath, nil
 }
 
-func ValidateInterval(val *string) (*uint16, error) {
+func ValidateInterval(val *string) (*Interval, error) {
 	if val == nil {
 		return nil, fmt.Errorf("--interval must have an argument. got none")
 	}
-	num, err := strconv.Atoi(*val)
+	interval, err := ParseInterval(*val)
 	if err != nil {
-		return nil, fmt.Errorf("invalid arg '%s' for --interval: %s", *val, err.Error())
+		return nil, fmt.Errorf("invalid arg '%s' for --interval: %s", *val, err)
 	}
-	if num < 1 {
-		return nil, fmt.Errorf("invalid arg '%s' for --interval: must be greater than 0", *val)
+	if interval.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid arg '%s' for --interval: never matches", *val)
 	}
-	if num > 65536 {
-		return nil, fmt.Errorf(
-			"invalid arg '%d' for --interval: can only be up to 65535 seconds (18.2 hours).",
-			num,
-		)
-	}
-	ret := uint16(num)
-	return &ret, nil
+	return &interval, nil
 }
 
-func ValidateOpacity(val *string) (*float32, error) {
+func ValidateOpacity(val *string) (*Opacity, error) {
 	if val == nil {
-		return nil, fmt.Errorf("--interval must have an argument. got none")
+		return nil, fmt.Errorf("--opacity must have an argument. got none")
 	}
-	num, err := strconv.ParseFloat(*val, 64)
+	opacity, err := ParseOpacity(*val)
 	if err != nil {
 		return nil, fmt.Errorf("invalid arg '%s' for --opacity: %s", *val, err.Error())
 	}
-	if num < 0 || num > 1 {
-		return nil, fmt.Errorf("invalid arg '%s' for --opacity: must be between 0 and 1", *val)
-	}
-	ret := float32(num)
-	return &ret, nil
+	return &opacity, nil
 }
 
 func ValidatePort(val *string) (*uint16, error) {
@@ -102,15 +93,79 @@ func ValidateProfile(val *string) (*string, error) {
 	return val, nil
 }
 
+func ValidateSelection(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("selection must have a value. got none")
+	}
+	switch *val {
+	case RandomSelection, ShuffleSelection, SequentialSelection:
+		return val, nil
+	default:
+		return nil, fmt.Errorf(`invalid value '%s' for selection: unknown selection
+[random shuffle sequential]`, *val)
+	}
+}
+
+// per path selection only chooses between images under the path
+func ValidatePathSelection(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("selection must have a value. got none")
+	}
+	switch *val {
+	case RandomSelection, SequentialSelection:
+		return val, nil
+	default:
+		return nil, fmt.Errorf(`invalid value '%s' for selection: unknown selection
+[random sequential]`, *val)
+	}
+}
+
+func ValidateOrder(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("order must have a value. got none")
+	}
+	switch *val {
+	case NameOrder, NameDescOrder, NaturalOrder, NaturalDescOrder, MtimeOrder, MtimeDescOrder:
+		return val, nil
+	default:
+		return nil, fmt.Errorf(`invalid value '%s' for order: unknown order
+[name name-desc natural natural-desc mtime mtime-desc]`, *val)
+	}
+}
+
+func ValidateWeighting(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("weighting must have a value. got none")
+	}
+	switch *val {
+	case WeightWeighting, CountWeighting:
+		return val, nil
+	default:
+		return nil, fmt.Errorf(`invalid value '%s' for weighting: unknown weighting
+[weight count]`, *val)
+	}
+}
+
+func ValidateFormat(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("format must have a value. got none")
+	}
+	if slices.Contains(SupportedFormats, *val) {
+		return val, nil
+	}
+	return nil, fmt.Errorf(`invalid value '%s' for format: unknown format
+%v`, *val, SupportedFormats)
+}
+
 func ValidateStretch(val *string) (*string, error) {
 	if val == nil {
 		return nil, fmt.Errorf("--stretch must have an argument. got none")
 	}
 	switch *val {
-	case "none", "fill", "uniform", "uniformToFill":
+	case "none", "fill", "uniform", "uniformToFill", AutoLayout:
 		return val, nil
 	default:
 		return nil, fmt.Errorf(`invalid arg '%s' for --stretch: unknown stretch
-[fill uniform uniformToFill none]`, *val)
+[fill uniform uniformToFill none auto]`, *val)
 	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Image formats recognized by their magic numbers
+const (
+	PngFormat  string = "png"
+	JpegFormat string = "jpeg"
+	GifFormat  string = "gif"
+	WebpFormat string = "webp"
+	BmpFormat  string = "bmp"
+	IcoFormat  string = "ico"
+	TiffFormat string = "tiff"
+	AvifFormat string = "avif"
+	JxlFormat  string = "jxl"
+)
+
+// Every format ImageFormat() can detect. Used when neither the config nor the
+// path sets "formats"
+var SupportedFormats = []string{
+	PngFormat, JpegFormat, GifFormat, WebpFormat, BmpFormat,
+	IcoFormat, TiffFormat, AvifFormat, JxlFormat,
+}
+
+// bytes read from the start of a file to detect its format
+const formatHeaderSize = 64
+
+// Format of the image file at path, or "" if it is not an image in any of the
+// SupportedFormats (or cannot be read). The path can be of an image in an
+// archive
+func ImageFormat(path string) string {
+	handle, err := openFile(path)
+	if err != nil {
+		return ""
+	}
+	defer handle.Close()
+	return readFormat(handle)
+}
+
+// Format of the image read from r. See ImageFormat()
+func readFormat(r io.Reader) string {
+	header := make([]byte, formatHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return DetectFormat(header[:n])
+}
+
+// Format of the image starting with header, or "" if it is not recognized
+func DetectFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return PngFormat
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff}):
+		return JpegFormat
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return GifFormat
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return WebpFormat
+	case isBmp(header):
+		return BmpFormat
+	case isIco(header):
+		return IcoFormat
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")),
+		// BigTIFF
+		bytes.HasPrefix(header, []byte("II+\x00")), bytes.HasPrefix(header, []byte("MM\x00+")):
+		return TiffFormat
+	case isAvif(header):
+		return AvifFormat
+	// bare codestream or ISO BMFF container
+	case bytes.HasPrefix(header, []byte{0xff, 0x0a}),
+		bytes.HasPrefix(header, []byte("\x00\x00\x00\x0cJXL \r\n\x87\n")):
+		return JxlFormat
+	default:
+		return ""
+	}
+}
+
+// "BM" alone is too common at the start of text files so the size of the DIB
+// header that follows the file header is checked as well
+func isBmp(header []byte) bool {
+	if len(header) < 18 || !bytes.HasPrefix(header, []byte("BM")) {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(header[14:18]) {
+	case 12, 16, 40, 52, 56, 64, 108, 124:
+		return true
+	default:
+		return false
+	}
+}
+
+// reserved 0, type 1 (icon), and at least one image
+func isIco(header []byte) bool {
+	return len(header) >= 6 &&
+		bytes.HasPrefix(header, []byte{0x00, 0x00, 0x01, 0x00}) &&
+		binary.LittleEndian.Uint16(header[4:6]) > 0
+}
+
+// ISO BMFF "ftyp" box with "avif" (still) or "avis" (sequence) as either the
+// major brand or one of the compatible brands
+func isAvif(header []byte) bool {
+	if len(header) < 16 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+	size := min(int(binary.BigEndian.Uint32(header[:4])), len(header))
+	// major brand at 8, minor version at 12, compatible brands from 16
+	for i := 8; i+4 <= size; i += 4 {
+		if i == 12 {
+			continue
+		}
+		switch string(header[i : i+4]) {
+		case "avif", "avis":
+			return true
+		}
+	}
+	return false
+}
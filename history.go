@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Max number of images kept in TbgState.History. The oldest entries are
+// dropped first
+const HistorySize = 100
+
+// An image set through TbgState.setImage()
+type HistoryEntry struct {
+	Image     string    `json:"image"`
+	Alignment string    `json:"alignment"`
+	Opacity   float32   `json:"opacity"`
+	Stretch   string    `json:"stretch"`
+	Time      time.Time `json:"time"`
+}
+
+// Asks the event handler for a copy of the history, which it sends back
+// through Response
+type HistoryEvent struct {
+	Response chan HistoryResponseBody
+}
+
+// Adds a newly set image after the current position, discarding entries that
+// could have been reached through TbgState.forwardImage(). Must only be called
+// by TbgState.eventHandler()
+func (tbg *TbgState) pushHistory(entry HistoryEntry) {
+	if len(tbg.History) > 0 {
+		tbg.History = tbg.History[:tbg.HistoryIndex+1]
+	}
+	tbg.History = append(tbg.History, entry)
+	if len(tbg.History) > HistorySize {
+		tbg.History = tbg.History[len(tbg.History)-HistorySize:]
+	}
+	tbg.HistoryIndex = len(tbg.History) - 1
+}
+
+// Sets the image before the current one in the history as the background
+// image, along with the properties it was set with
+func (tbg *TbgState) previousImage() error {
+	if tbg.HistoryIndex <= 0 {
+		slog.Info("No previous image in history")
+		return nil
+	}
+	return tbg.goToHistory(tbg.HistoryIndex-1, PreviousImageTrigger)
+}
+
+// Sets the image after the current one in the history as the background
+// image. Only possible after going back through TbgState.previousImage()
+func (tbg *TbgState) forwardImage() error {
+	if tbg.HistoryIndex >= len(tbg.History)-1 {
+		slog.Info("No forward image in history")
+		return nil
+	}
+	return tbg.goToHistory(tbg.HistoryIndex+1, ForwardImageTrigger)
+}
+
+// The index is updated before setting the image so it is what gets saved by
+// TbgState.saveState()
+func (tbg *TbgState) goToHistory(index int, trigger ImageChangeTrigger) error {
+	entry := tbg.History[index]
+	oldIndex := tbg.HistoryIndex
+	tbg.HistoryIndex = index
+	err := tbg.setImage(trigger, entry.Image, entry.Alignment, Opacity(entry.Opacity), entry.Stretch)
+	if err != nil {
+		// e.g. the image could not be extracted from its archive
+		tbg.HistoryIndex = oldIndex
+	}
+	return err
+}
+
+// Copy of the history served through /history
+func (tbg *TbgState) history() HistoryResponseBody {
+	entries := make([]HistoryEntry, len(tbg.History))
+	copy(entries, tbg.History)
+	return HistoryResponseBody{
+		Index:   tbg.HistoryIndex,
+		Entries: entries,
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Bumped whenever IndexEntry changes meaning so old indexes are rebuilt instead
+// of misread
+const ImageIndexVersion = 2
+
+// Cached result of ImageFormat, ImageDimensions, and ImageLuminance for a
+// file. It stays valid as long as the size and modification time of the file
+// do not change
+type IndexEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// empty if the file is not an image
+	Format string `json:"format,omitempty"`
+	// zero if the dimensions of the format cannot be read
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// average luminance from 0 to 1. Only computed once an image is used
+	// with "opacity: auto". See ImageLuminance()
+	Luminance *float64 `json:"luminance,omitempty"`
+}
+
+// Opens the file to check its format, and its dimensions if it is an image
+func newIndexEntry(full string, info fs.FileInfo) IndexEntry {
+	return readIndexEntry(full, info, func() (io.ReadCloser, error) {
+		return openFile(full)
+	})
+}
+
+// Same as newIndexEntry() but the file is opened with open, once for its
+// format and once for its dimensions
+func readIndexEntry(full string, info fs.FileInfo, open func() (io.ReadCloser, error)) IndexEntry {
+	entry := IndexEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if handle, err := open(); err == nil {
+		entry.Format = readFormat(handle)
+		handle.Close()
+	}
+	if entry.Format != "" {
+		handle, err := open()
+		if err == nil {
+			entry.Width, entry.Height, err = readDimensions(handle)
+			handle.Close()
+		}
+		if err != nil {
+			slog.Warn("Failed to read image dimensions", "path", full, "error", err)
+		}
+	}
+	return entry
+}
+
+// Persistent cache of which files are images, shared by all paths so scanning
+// only opens files that are new or changed since they were last checked.
+//
+// Entries are grouped by directory then by file name. Walking a directory
+// drops the entries of files no longer in it
+type ImageIndex struct {
+	// where the index is saved. See IndexPath()
+	Path    string                           `json:"-"`
+	Version int                              `json:"version"`
+	Dirs    map[string]map[string]IndexEntry `json:"dirs"`
+	// modification time of the index file when it was last read or written.
+	// A different one means it was rebuilt through `tbg index rebuild`
+	loaded time.Time
+	// whether there are changes not yet saved
+	dirty bool
+	// files opened to check if they are images since the last save
+	checked int
+}
+
+// The index is in the same directory as the config (where tbg.log is). Unlike
+// the state, it is shared by every server since it only caches file contents
+func IndexPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "index.json")
+}
+
+func NewImageIndex(path string) *ImageIndex {
+	return &ImageIndex{
+		Path:    path,
+		Version: ImageIndexVersion,
+		Dirs:    make(map[string]map[string]IndexEntry),
+	}
+}
+
+// Reads the index at path. A missing or unreadable index means starting with
+// an empty one, which is filled as paths are scanned
+func LoadImageIndex(path string) *ImageIndex {
+	index := NewImageIndex(path)
+	if err := index.read(); err != nil {
+		if os.IsNotExist(err) {
+			slog.Info("No image index yet", "path", path)
+		} else {
+			slog.Warn("Failed to read image index, starting over", "path", path, "error", err)
+		}
+		return index
+	}
+	slog.Info("Loaded image index", "path", path, "dirs", len(index.Dirs), "files", index.files())
+	return index
+}
+
+func (index *ImageIndex) read() error {
+	info, err := os.Stat(index.Path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(index.Path)
+	if err != nil {
+		return err
+	}
+	var saved struct {
+		Version int                              `json:"version"`
+		Dirs    map[string]map[string]IndexEntry `json:"dirs"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if saved.Version != ImageIndexVersion {
+		return fmt.Errorf("index version %d is outdated (current: %d)", saved.Version, ImageIndexVersion)
+	}
+	index.Dirs = saved.Dirs
+	if index.Dirs == nil {
+		index.Dirs = make(map[string]map[string]IndexEntry)
+	}
+	index.loaded = info.ModTime()
+	index.dirty = false
+	return nil
+}
+
+// Reads the index again if it was written by something else since it was last
+// read or written (e.g. `tbg index rebuild`), discarding unsaved changes
+func (index *ImageIndex) Reload() {
+	if index == nil {
+		return
+	}
+	info, err := os.Stat(index.Path)
+	if err != nil || info.ModTime().Equal(index.loaded) {
+		return
+	}
+	if err := index.read(); err != nil {
+		slog.Warn("Failed to reload image index", "path", index.Path, "error", err)
+		return
+	}
+	slog.Info("Reloaded image index", "path", index.Path, "dirs", len(index.Dirs), "files", index.files())
+}
+
+// Writes the index if it changed since it was last read or written
+func (index *ImageIndex) Save() error {
+	if index == nil || !index.dirty {
+		return nil
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal image index: %s", err)
+	}
+	// multiple servers may share the index so each writes to its own
+	// temporary file before replacing it
+	tmp, err := os.CreateTemp(filepath.Dir(index.Path), "index_*.json.tmp")
+	if err != nil {
+		return fmt.Errorf("Failed to write image index: %s", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Failed to write image index: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), index.Path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Failed to write image index: %s", err)
+	}
+	if info, err := os.Stat(index.Path); err == nil {
+		index.loaded = info.ModTime()
+	}
+	slog.Info("Saved image index", "path", index.Path, "dirs", len(index.Dirs), "files", index.files(), "checked", index.checked)
+	index.dirty = false
+	index.checked = 0
+	return nil
+}
+
+func (index *ImageIndex) files() int {
+	count := 0
+	for _, entries := range index.Dirs {
+		count += len(entries)
+	}
+	return count
+}
+
+// Entries of a directory being walked. Entries are carried over from the last
+// walk for files still in the directory; the rest are dropped on
+// ImageIndex.commit()
+type indexDir struct {
+	index   *ImageIndex
+	dir     string
+	last    map[string]IndexEntry
+	entries map[string]IndexEntry
+}
+
+// Starts walking dir. Works on a nil index as well, in which case every file
+// is opened to check its format
+func (index *ImageIndex) walk(dir string) *indexDir {
+	if index == nil {
+		return &indexDir{dir: dir}
+	}
+	return &indexDir{
+		index:   index,
+		dir:     dir,
+		last:    index.Dirs[dir],
+		entries: make(map[string]IndexEntry),
+	}
+}
+
+// Keeps the entry of a file that is in the directory but was not checked
+// (e.g. it is excluded by this path but may be included by another)
+func (d *indexDir) keep(name string) {
+	if d.index == nil {
+		return
+	}
+	if entry, ok := d.last[name]; ok {
+		d.entries[name] = entry
+	}
+}
+
+// Format (empty if not an image) and dimensions of the file, only opening it
+// if it is not in the index or it changed since it was last checked
+func (d *indexDir) entry(name string, info fs.FileInfo) IndexEntry {
+	full := filepath.Join(d.dir, name)
+	if d.index == nil {
+		return newIndexEntry(full, info)
+	}
+	entry, ok := d.last[name]
+	if ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		d.entries[name] = entry
+		return entry
+	}
+	entry = newIndexEntry(full, info)
+	d.entries[name] = entry
+	d.index.checked++
+	d.index.dirty = true
+	return entry
+}
+
+// Format and dimensions of a single file that is not found by walking its
+// directory (e.g. a playlist entry), keeping the other entries of the
+// directory
+func (index *ImageIndex) fileEntry(full string, info fs.FileInfo) IndexEntry {
+	return index.cachedEntry(full, info, func() IndexEntry {
+		return newIndexEntry(full, info)
+	})
+}
+
+// Entry of the file in the index, replaced with the one made by newEntry if
+// it is missing or the file changed
+func (index *ImageIndex) cachedEntry(full string, info fs.FileInfo, newEntry func() IndexEntry) IndexEntry {
+	if index == nil {
+		return newEntry()
+	}
+	dir, name := filepath.Dir(full), filepath.Base(full)
+	entries, ok := index.Dirs[dir]
+	if !ok {
+		entries = make(map[string]IndexEntry)
+		index.Dirs[dir] = entries
+	}
+	entry, ok := entries[name]
+	if ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return entry
+	}
+	entry = newEntry()
+	entries[name] = entry
+	index.checked++
+	index.dirty = true
+	return entry
+}
+
+// Replaces the entries of the directory with the ones kept while walking it
+func (d *indexDir) commit() {
+	if d.index == nil {
+		return
+	}
+	if len(d.entries) != len(d.last) {
+		d.index.dirty = true
+	}
+	if len(d.entries) == 0 {
+		delete(d.index.Dirs, d.dir)
+		return
+	}
+	d.index.Dirs[d.dir] = d.entries
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Time between image changes. Written in the config as either:
+//
+//  1. seconds: 1800
+//  2. a duration: "90m", "2h30m", "1d12h" (d is 24 hours)
+//  3. a cron expression: "cron: 0 9 * * mon-fri". See Cron
+type Interval struct {
+	// fixed time between image changes. Zero if Cron is set
+	Every time.Duration
+	// image changes happen at the times matched by the expression instead
+	Cron *Cron
+	// as written in the config, to write it back the same way
+	raw string
+}
+
+var daysPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)d`)
+
+func ParseInterval(s string) (Interval, error) {
+	raw := strings.TrimSpace(s)
+	if expr, ok := strings.CutPrefix(raw, "cron:"); ok {
+		cron, err := ParseCron(expr)
+		if err != nil {
+			return Interval{}, err
+		}
+		return Interval{Cron: cron, raw: raw}, nil
+	}
+	every, err := ParseDuration(raw)
+	if err != nil {
+		return Interval{}, err
+	}
+	if every < time.Second {
+		return Interval{}, fmt.Errorf("must be at least 1 second. got: %s", every)
+	}
+	return Interval{Every: every, raw: raw}, nil
+}
+
+// Like time.ParseDuration, with plain numbers as seconds and "d" as 24 hours
+// (only as the first unit, e.g. "1d12h")
+func ParseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	var days time.Duration
+	if match := daysPattern.FindStringSubmatch(s); match != nil {
+		n, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		days = time.Duration(n * float64(24*time.Hour))
+		s = s[len(match[0]):]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%s': expected seconds (1800), a duration (90m, 2h30m, 1d12h), or a cron expression (cron: 0 9 * * mon-fri)", s)
+	}
+	return days + d, nil
+}
+
+// First image change after t. Zero if a cron expression never matches
+func (interval Interval) Next(t time.Time) time.Time {
+	if interval.Cron != nil {
+		return interval.Cron.Next(t)
+	}
+	return t.Add(interval.Every)
+}
+
+func (interval Interval) String() string {
+	if interval.raw != "" {
+		return interval.raw
+	}
+	if interval.Cron != nil {
+		return "cron: " + interval.Cron.String()
+	}
+	return interval.Every.String()
+}
+
+func (interval *Interval) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := ParseInterval(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid interval: %s", node.Line, err)
+	}
+	*interval = parsed
+	return nil
+}
+
+// Written back as seconds if it was seconds so existing configs do not change
+func (interval Interval) MarshalYAML() (any, error) {
+	if seconds, err := strconv.ParseUint(interval.raw, 10, 32); err == nil {
+		return seconds, nil
+	}
+	return interval.String(), nil
+}
+
+// A duration written in the config as seconds or a duration string. See
+// ParseDuration()
+type Duration struct {
+	time.Duration
+	// as written in the config, to write it back the same way
+	raw string
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(strings.TrimSpace(raw))
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	*d = Duration{Duration: parsed, raw: raw}
+	return nil
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	if seconds, err := strconv.ParseUint(d.raw, 10, 32); err == nil {
+		return seconds, nil
+	}
+	if d.raw != "" {
+		return d.raw, nil
+	}
+	return d.Duration.String(), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+// Value of alignment and stretch that chooses them from the aspect ratio of
+// the image relative to the terminal. See Config.LayoutRuleOf()
+const AutoLayout = "auto"
+
+const DefaultTerminalAspectRatio = "16:9"
+
+// Alignment and stretch of images whose aspect ratio divided by the one of
+// the terminal is in Ratio. A ratio below 1 means the image is narrower than
+// the terminal
+type LayoutRule struct {
+	// every image matches if not set
+	Ratio     *AspectRatio `yaml:"ratio,omitempty"`
+	Alignment *string      `yaml:"alignment,omitempty"`
+	Stretch   *string      `yaml:"stretch,omitempty"`
+}
+
+// Used when auto_layout is not set: images much narrower than the terminal
+// (e.g. portraits) are shown whole on the right so text on the left stays
+// readable, the rest fill the terminal
+var DefaultLayoutRules = []LayoutRule{
+	{
+		Ratio:     &AspectRatio{Max: 0.75, raw: "-0.75"},
+		Alignment: func() *string { s := "right"; return &s }(),
+		Stretch:   func() *string { s := "uniform"; return &s }(),
+	},
+	{
+		Alignment: func() *string { s := "center"; return &s }(),
+		Stretch:   func() *string { s := "uniformToFill"; return &s }(),
+	},
+}
+
+// returns the terminal aspect ratio if it is set. otherwise, it returns the
+// default terminal aspect ratio (16:9)
+func (cfg *Config) TerminalAspectRatioOrDefault() float64 {
+	ratio, err := parseRatio(Option(cfg.TerminalAspectRatio).UnwrapOr(DefaultTerminalAspectRatio))
+	if err != nil || ratio == 0 {
+		ratio, _ = parseRatio(DefaultTerminalAspectRatio)
+	}
+	return ratio
+}
+
+// returns the auto_layout rules if set. otherwise, DefaultLayoutRules
+func (cfg *Config) LayoutRulesOrDefault() []LayoutRule {
+	if len(cfg.AutoLayout) == 0 {
+		return DefaultLayoutRules
+	}
+	return cfg.AutoLayout
+}
+
+// The first rule matching the aspect ratio of the image divided by the one of
+// the terminal, and its index. -1 if no rule matches
+func (cfg *Config) LayoutRuleOf(ratio float64) (LayoutRule, int) {
+	for i, rule := range cfg.LayoutRulesOrDefault() {
+		if rule.Ratio == nil || rule.Ratio.contains(ratio) {
+			return rule, i
+		}
+	}
+	return LayoutRule{}, -1
+}
+
+func (cfg *Config) validateLayout() []error {
+	errs := make([]error, 0)
+	if cfg.TerminalAspectRatio != nil {
+		if ratio, err := parseRatio(*cfg.TerminalAspectRatio); err != nil {
+			errs = append(errs, fmt.Errorf("terminal_aspect_ratio: %s", err))
+		} else if ratio == 0 {
+			errs = append(errs, fmt.Errorf("terminal_aspect_ratio: must not be empty"))
+		}
+	}
+	for i, rule := range cfg.AutoLayout {
+		if rule.Alignment != nil {
+			if *rule.Alignment == AutoLayout {
+				errs = append(errs, fmt.Errorf("auto_layout rule %d alignment: cannot be auto", i+1))
+			} else if _, err := ValidateAlignment(rule.Alignment); err != nil {
+				errs = append(errs, fmt.Errorf("auto_layout rule %d alignment: %s", i+1, err))
+			}
+		}
+		if rule.Stretch != nil {
+			if *rule.Stretch == AutoLayout {
+				errs = append(errs, fmt.Errorf("auto_layout rule %d stretch: cannot be auto", i+1))
+			} else if _, err := ValidateStretch(rule.Stretch); err != nil {
+				errs = append(errs, fmt.Errorf("auto_layout rule %d stretch: %s", i+1, err))
+			}
+		}
+	}
+	return errs
+}
+
+// Dimensions of the image from its index entry, reading them if the image is
+// not in the index yet. Zero if they cannot be read
+func (index *ImageIndex) dimensions(full string) (int, int) {
+	info, err := statFile(full)
+	if err != nil {
+		return 0, 0
+	}
+	entry := index.fileEntry(full, info)
+	return entry.Width, entry.Height
+}
+
+// Replaces an "auto" alignment or stretch with the one of the auto_layout rule
+// matching the image. The defaults are used if the dimensions of the image are
+// unknown or no rule matches
+func (tbg *TbgState) resolveLayout(image string, alignment string, stretch string) (string, string) {
+	if alignment != AutoLayout && stretch != AutoLayout {
+		return alignment, stretch
+	}
+	replaceAuto := func(val string, chosen *string, fallback string) string {
+		if val != AutoLayout {
+			return val
+		}
+		return Option(chosen).UnwrapOr(fallback)
+	}
+	width, height := tbg.Index.dimensions(image)
+	if err := tbg.Index.Save(); err != nil {
+		slog.Warn("Failed to save image index", "error", err)
+	}
+	if width == 0 || height == 0 {
+		alignment = replaceAuto(alignment, nil, DefaultAlignment)
+		stretch = replaceAuto(stretch, nil, DefaultStretch)
+		slog.Warn("Unknown image dimensions, using the default alignment and stretch",
+			"image", image,
+			"alignment", alignment,
+			"stretch", stretch,
+		)
+		return alignment, stretch
+	}
+	ratio := float64(width) / float64(height) / tbg.Config.TerminalAspectRatioOrDefault()
+	rule, i := tbg.Config.LayoutRuleOf(ratio)
+	alignment = replaceAuto(alignment, rule.Alignment, DefaultAlignment)
+	stretch = replaceAuto(stretch, rule.Stretch, DefaultStretch)
+	slog.Info("Chose layout from image aspect ratio",
+		"image", image,
+		"relative-aspect-ratio", strconv.FormatFloat(ratio, 'f', 2, 64),
+		"rule", i+1,
+		"alignment", alignment,
+		"stretch", stretch,
+	)
+	return alignment, stretch
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultAutoOpacityMin float32 = 0.1
+	DefaultAutoOpacityMax float32 = 0.5
+)
+
+// Opacity of the background image from 0 to 1, or AutoOpacity to choose one
+// from how bright the image is. Written as a number or "auto"
+type Opacity float32
+
+// Bright images get a lower opacity so the text stays readable, and dark ones
+// a higher opacity so they are still visible. See Config.AutoOpacityOf()
+const AutoOpacity Opacity = -1
+
+func ParseOpacity(s string) (Opacity, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "auto") {
+		return AutoOpacity, nil
+	}
+	num, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return 0, err
+	}
+	if num < 0 || num > 1 {
+		return 0, fmt.Errorf("must be between 0 and 1, or auto")
+	}
+	return Opacity(num), nil
+}
+
+func (opacity Opacity) IsAuto() bool { return opacity == AutoOpacity }
+
+func (opacity Opacity) String() string {
+	if opacity.IsAuto() {
+		return "auto"
+	}
+	return strconv.FormatFloat(float64(opacity), 'f', -1, 32)
+}
+
+func (opacity *Opacity) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := ParseOpacity(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid opacity '%s': %s", node.Line, node.Value, err)
+	}
+	*opacity = parsed
+	return nil
+}
+
+func (opacity Opacity) MarshalYAML() (any, error) {
+	if opacity.IsAuto() {
+		return "auto", nil
+	}
+	return float32(opacity), nil
+}
+
+func (opacity *Opacity) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	parsed, err := ParseOpacity(fmt.Sprint(raw))
+	if err != nil {
+		return fmt.Errorf("invalid opacity %s: %s", data, err)
+	}
+	*opacity = parsed
+	return nil
+}
+
+func (opacity Opacity) MarshalJSON() ([]byte, error) {
+	if opacity.IsAuto() {
+		return json.Marshal("auto")
+	}
+	return json.Marshal(float32(opacity))
+}
+
+// Range of opacities "auto" chooses from. The brightest images get Min and the
+// darkest get Max
+type OpacityRange struct {
+	Min *float32 `yaml:"min,omitempty"`
+	Max *float32 `yaml:"max,omitempty"`
+}
+
+func (r OpacityRange) String() string {
+	return fmt.Sprint(
+		strconv.FormatFloat(float64(Option(r.Min).UnwrapOr(DefaultAutoOpacityMin)), 'f', -1, 32),
+		"-",
+		strconv.FormatFloat(float64(Option(r.Max).UnwrapOr(DefaultAutoOpacityMax)), 'f', -1, 32),
+	)
+}
+
+func (r OpacityRange) Validate() error {
+	low := Option(r.Min).UnwrapOr(DefaultAutoOpacityMin)
+	high := Option(r.Max).UnwrapOr(DefaultAutoOpacityMax)
+	if low < 0 || low > 1 {
+		return fmt.Errorf("min must be between 0 and 1. got %s", strconv.FormatFloat(float64(low), 'f', -1, 32))
+	}
+	if high < 0 || high > 1 {
+		return fmt.Errorf("max must be between 0 and 1. got %s", strconv.FormatFloat(float64(high), 'f', -1, 32))
+	}
+	if low > high {
+		return fmt.Errorf("min (%s) is greater than max (%s)",
+			strconv.FormatFloat(float64(low), 'f', -1, 32),
+			strconv.FormatFloat(float64(high), 'f', -1, 32),
+		)
+	}
+	return nil
+}
+
+// Average luminance of the image at path, from 0 (black) to 1 (white). Large
+// images are sampled on a grid of at most 256x256 pixels.
+func ImageLuminance(path string) (float64, error) {
+	img, err := DecodeImage(path)
+	if err != nil {
+		return 0, err
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 0, fmt.Errorf("%s has no pixels", path)
+	}
+	stepX := max(bounds.Dx()/256, 1)
+	stepY := max(bounds.Dy()/256, 1)
+	var sum float64
+	var count int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// Rec. 709 luma of the 16 bit channels
+			sum += (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+			count++
+		}
+	}
+	return sum / float64(count), nil
+}
+
+// Luminance of the image, computed once and cached in its index entry until
+// the file changes. Whether it was cached is returned as well
+func (index *ImageIndex) luminance(full string) (float64, bool, error) {
+	info, err := statFile(full)
+	if err != nil {
+		return 0, false, err
+	}
+	entry := index.fileEntry(full, info)
+	if entry.Luminance != nil {
+		return *entry.Luminance, true, nil
+	}
+	luminance, err := ImageLuminance(full)
+	if err != nil {
+		return 0, false, err
+	}
+	if index != nil {
+		entry.Luminance = &luminance
+		index.Dirs[filepath.Dir(full)][filepath.Base(full)] = entry
+		index.dirty = true
+	}
+	return luminance, false, nil
+}
+
+// Opacity to use for the image. AutoOpacity is mapped from the luminance of the
+// image to the auto_opacity range, or the middle of it if the luminance cannot
+// be computed
+func (tbg *TbgState) resolveOpacity(image string, opacity Opacity) float32 {
+	if !opacity.IsAuto() {
+		return float32(opacity)
+	}
+	tbg.Index.Reload()
+	luminance, cached, err := tbg.Index.luminance(image)
+	if err := tbg.Index.Save(); err != nil {
+		slog.Warn("Failed to save image index", "error", err)
+	}
+	if err != nil {
+		chosen := tbg.Config.AutoOpacityOf(0.5)
+		slog.Warn("Failed to compute image luminance, using the middle of auto_opacity",
+			"image", image,
+			"error", err,
+			"opacity", chosen,
+		)
+		return chosen
+	}
+	chosen := tbg.Config.AutoOpacityOf(luminance)
+	slog.Info("Chose opacity from image luminance",
+		"image", image,
+		"luminance", strconv.FormatFloat(luminance, 'f', 3, 64),
+		"cached", cached,
+		"opacity", chosen,
+	)
+	return chosen
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// What ImagesPath.Path points to
+const (
+	// images under the directory (and its subdirectories if recursive)
+	DirectoryPathKind string = "directory"
+	// just the one image
+	ImagePathKind string = "image"
+	// the images listed in the file. See ReadPlaylist()
+	PlaylistPathKind string = "playlist"
+	// the images inside the zip file. See IsArchive()
+	ArchivePathKind string = "archive"
+	// the images downloaded from the feed into the directory. See
+	// RefreshFeed()
+	FeedPathKind string = "feed"
+	// the images listed by the command run in the directory. See
+	// ImagesPath.runExec()
+	ExecPathKind string = "exec"
+)
+
+// Properties of a single image, overriding the ones of its path
+type ImageProps struct {
+	Alignment *string
+	Opacity   *Opacity
+	Stretch   *string
+}
+
+type PlaylistEntry struct {
+	// absolute path of the image
+	Image string
+	Props ImageProps
+	// line number in the playlist, starting at 1
+	Line int
+}
+
+type Playlist struct {
+	Path    string
+	Entries []PlaylistEntry
+	// lines that could not be parsed. These are skipped
+	Errors []error
+}
+
+// Reads a playlist file, which lists one image per line:
+//
+//	# lines starting with "#" and empty lines are ignored
+//	~/Pictures/favorite.png
+//	relative/to/the/playlist.jpg | alignment=right opacity=0.5 stretch=fill
+//
+// Paths can use ~ and environment variables like ImagesPath.Path. Relative
+// paths are resolved against the directory of the playlist. Properties after
+// "|" override the ones of the path for that image.
+func ReadPlaylist(path string) (*Playlist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open playlist %s: %s", path, err)
+	}
+	defer file.Close()
+	playlist := &Playlist{Path: path}
+	dir := filepath.Dir(path)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := parsePlaylistLine(dir, text)
+		if err != nil {
+			playlist.Errors = append(playlist.Errors, fmt.Errorf("line %d: %s", line, err))
+			continue
+		}
+		entry.Line = line
+		playlist.Entries = append(playlist.Entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read playlist %s: %s", path, err)
+	}
+	return playlist, nil
+}
+
+func parsePlaylistLine(dir, text string) (PlaylistEntry, error) {
+	var entry PlaylistEntry
+	image, props, _ := strings.Cut(text, "|")
+	image = strings.TrimSpace(image)
+	if image == "" {
+		return entry, fmt.Errorf("missing image path")
+	}
+	image = expandEnv(image)
+	if !filepath.IsAbs(image) {
+		image = filepath.Join(dir, image)
+	}
+	entry.Image = filepath.ToSlash(filepath.Clean(image))
+	for _, prop := range strings.Fields(props) {
+		key, val, ok := strings.Cut(prop, "=")
+		if !ok {
+			return entry, fmt.Errorf("expected key=value. got: '%s'", prop)
+		}
+		var err error
+		switch key {
+		case "alignment":
+			entry.Props.Alignment, err = ValidateAlignment(&val)
+		case "opacity":
+			entry.Props.Opacity, err = ValidateOpacity(&val)
+		case "stretch":
+			entry.Props.Stretch, err = ValidateStretch(&val)
+		default:
+			err = fmt.Errorf("unknown property '%s'. valid properties: alignment, opacity, stretch", key)
+		}
+		if err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+// Kind and playlist of each path as of the last time it was scanned, keyed
+// by its absolute path, so finding the interval or properties of an image
+// (e.g. on every /status request) does not read the path again
+type scannedPathCache struct {
+	mu        sync.Mutex
+	kinds     map[string]string
+	playlists map[string]*Playlist
+}
+
+var scannedPaths = &scannedPathCache{
+	kinds:     make(map[string]string),
+	playlists: make(map[string]*Playlist),
+}
+
+// "" if the path was not scanned yet
+func (cache *scannedPathCache) kind(absPath string) string {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.kinds[absPath]
+}
+
+// nil if the path was not scanned yet
+func (cache *scannedPathCache) playlist(absPath string) *Playlist {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.playlists[absPath]
+}
+
+// An empty kind or a nil playlist forgets the path. Feeds and commands are
+// not kept since their kind does not depend on the path
+func (cache *scannedPathCache) store(absPath string, kind string, playlist *Playlist) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if kind == "" {
+		delete(cache.kinds, absPath)
+	} else {
+		cache.kinds[absPath] = kind
+	}
+	if playlist == nil {
+		delete(cache.playlists, absPath)
+	} else {
+		cache.playlists[absPath] = playlist
+	}
+}
+
+// What the path points to: a directory, an image, an archive, or a playlist.
+// Any other file that is not an image is read as a playlist. Paths with a feed
+// are feeds even before their directory exists, and paths with a command are
+// commands. The kind found the last time the path was scanned is used if any
+func (path *ImagesPath) Kind() (string, error) {
+	absPath, err := NormalizePath(path.Path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to normalize path %s: %s", path.Path, err)
+	}
+	if path.Feed == nil && path.Exec == nil {
+		if kind := scannedPaths.kind(absPath); kind != "" {
+			return kind, nil
+		}
+	}
+	return path.kindOf(absPath)
+}
+
+// Same as ImagesPath.Kind() but always reads the path
+func (path *ImagesPath) kindOf(absPath string) (string, error) {
+	if path.Feed != nil {
+		return FeedPathKind, nil
+	}
+	if path.Exec != nil {
+		return ExecPathKind, nil
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return DirectoryPathKind, nil
+	}
+	if IsArchive(absPath) {
+		return ArchivePathKind, nil
+	}
+	if ImageFormat(absPath) != "" {
+		return ImagePathKind, nil
+	}
+	return PlaylistPathKind, nil
+}
+
+// Properties of the image set in the playlist of the path, or in the last
+// output of its command. Empty for other kinds of paths or if the image is
+// not listed
+func (path *ImagesPath) PropsOf(image string) ImageProps {
+	playlist := path.listed()
+	if playlist == nil {
+		return ImageProps{}
+	}
+	for _, entry := range playlist.Entries {
+		if entry.Image == filepath.ToSlash(image) {
+			return entry.Props
+		}
+	}
+	return ImageProps{}
+}
+
+// Whether the image is in the directory (or the directory of a feed), or
+// under it if it is recursive, is the image, is in the archive or playlist
+// the path points to, or was in the last output of its command
+func (path *ImagesPath) Contains(image string) bool {
+	absPath, err := NormalizePath(path.Path)
+	if err != nil {
+		return false
+	}
+	kind, err := path.Kind()
+	if err != nil {
+		return false
+	}
+	image = filepath.Clean(filepath.FromSlash(image))
+	switch kind {
+	case DirectoryPathKind, FeedPathKind:
+		if !Option(path.Recursive).UnwrapOr(false) {
+			// images in subdirectories are not used
+			return filepath.Dir(image) == filepath.Clean(absPath)
+		}
+		fallthrough
+	case ArchivePathKind:
+		rel, err := filepath.Rel(absPath, image)
+		return err == nil && rel != "." && !strings.HasPrefix(filepath.ToSlash(rel), "../")
+	case ImagePathKind:
+		return image == filepath.Clean(absPath)
+	default:
+		playlist := path.listed()
+		if playlist == nil {
+			return false
+		}
+		for _, entry := range playlist.Entries {
+			if entry.Image == filepath.ToSlash(image) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// The playlist of the path as of the last time it was scanned, or the last
+// output of its command without running it again. nil for other kinds of
+// paths or if it cannot be read
+func (path *ImagesPath) listed() *Playlist {
+	kind, err := path.Kind()
+	if err != nil {
+		return nil
+	}
+	switch kind {
+	case PlaylistPathKind:
+		absPath, err := NormalizePath(path.Path)
+		if err != nil {
+			return nil
+		}
+		if playlist := scannedPaths.playlist(absPath); playlist != nil {
+			return playlist
+		}
+		playlist, err := ReadPlaylist(absPath)
+		if err != nil {
+			return nil
+		}
+		return playlist
+	case ExecPathKind:
+		return path.lastExecOutput()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Largest size of images written to settings.json, written as "widthxheight"
+// (e.g. "3840x2160"). Larger images are downscaled to fit, keeping their
+// aspect ratio. Zero means no limit for that side so "0x0" turns it off
+type Dimensions struct {
+	Width  uint32
+	Height uint32
+}
+
+func ParseDimensions(s string) (Dimensions, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	if !ok {
+		return Dimensions{}, fmt.Errorf("invalid dimensions '%s': expected widthxheight (e.g. 3840x2160)", s)
+	}
+	width, err := strconv.ParseUint(strings.TrimSpace(w), 10, 32)
+	if err != nil {
+		return Dimensions{}, fmt.Errorf("invalid dimensions '%s': width must be a whole number", s)
+	}
+	height, err := strconv.ParseUint(strings.TrimSpace(h), 10, 32)
+	if err != nil {
+		return Dimensions{}, fmt.Errorf("invalid dimensions '%s': height must be a whole number", s)
+	}
+	return Dimensions{Width: uint32(width), Height: uint32(height)}, nil
+}
+
+func (d Dimensions) String() string {
+	return strconv.FormatUint(uint64(d.Width), 10) + "x" + strconv.FormatUint(uint64(d.Height), 10)
+}
+
+// whether it limits neither side
+func (d Dimensions) IsZero() bool {
+	return d.Width == 0 && d.Height == 0
+}
+
+func (d *Dimensions) UnmarshalYAML(node *yaml.Node) error {
+	var raw string
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	parsed, err := ParseDimensions(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Dimensions) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
+
+// Size of an image of width x height scaled down to fit, keeping its aspect
+// ratio. The size itself if it already fits
+func (d Dimensions) fit(width, height int) (int, int) {
+	scale := 1.0
+	if d.Width != 0 && width > int(d.Width) {
+		scale = min(scale, float64(d.Width)/float64(width))
+	}
+	if d.Height != 0 && height > int(d.Height) {
+		scale = min(scale, float64(d.Height)/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(int(math.Round(float64(width)*scale)), 1), max(int(math.Round(float64(height)*scale)), 1)
+}
+
+// Downscales the image to fit the max dimensions, keeping the image as is if
+// it already fits
+func (p Processing) downscale(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := p.MaxDimensions.fit(bounds.Dx(), bounds.Dy())
+	if width == bounds.Dx() && height == bounds.Dy() {
+		return img
+	}
+	return resample(img, width, height)
+}
+
+// Resamples the image to width x height with a Catmull-Rom filter, widened by
+// the scale when downscaling so every source pixel is taken into account.
+// Rows are resampled first, then columns
+func resample(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	// premultiplied so transparent pixels do not bleed their color
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, src, bounds.Min, draw.Src)
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	columns := resampleWeights(srcWidth, width)
+	tmp := make([]float32, width*srcHeight*4)
+	for y := range srcHeight {
+		row := rgba.Pix[y*rgba.Stride:]
+		for x, w := range columns {
+			var sum [4]float32
+			for i, weight := range w.weights {
+				px := row[(w.start+i)*4:]
+				for c := range sum {
+					sum[c] += weight * float32(px[c])
+				}
+			}
+			copy(tmp[(y*width+x)*4:], sum[:])
+		}
+	}
+
+	rows := resampleWeights(srcHeight, height)
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, w := range rows {
+		row := out.Pix[y*out.Stride:]
+		for x := range width {
+			var sum [4]float32
+			for i, weight := range w.weights {
+				px := tmp[((w.start+i)*width+x)*4:]
+				for c := range sum {
+					sum[c] += weight * px[c]
+				}
+			}
+			// the negative lobes of the filter can overshoot
+			alpha := min(max(sum[3], 0), 255)
+			for c := range 3 {
+				row[x*4+c] = uint8(min(max(sum[c], 0), alpha) + 0.5)
+			}
+			row[x*4+3] = uint8(alpha + 0.5)
+		}
+	}
+	return out
+}
+
+// Source pixels from start and their weights for one destination pixel
+type resampleWeight struct {
+	start   int
+	weights []float32
+}
+
+// Weights of the source pixels of each destination pixel when resampling a
+// line of srcLen pixels to dstLen pixels
+func resampleWeights(srcLen, dstLen int) []resampleWeight {
+	scale := max(float64(srcLen)/float64(dstLen), 1)
+	radius := 2 * scale
+	ret := make([]resampleWeight, dstLen)
+	for i := range ret {
+		center := (float64(i)+0.5)*float64(srcLen)/float64(dstLen) - 0.5
+		start := max(int(math.Ceil(center-radius)), 0)
+		end := min(int(math.Floor(center+radius)), srcLen-1)
+		weights := make([]float32, end-start+1)
+		var total float64
+		for j := range weights {
+			weight := catmullRom((float64(start+j) - center) / scale)
+			weights[j] = float32(weight)
+			total += weight
+		}
+		if total != 0 {
+			for j := range weights {
+				weights[j] /= float32(total)
+			}
+		}
+		ret[i] = resampleWeight{start: start, weights: weights}
+	}
+	return ret
+}
+
+func catmullRom(x float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return (1.5*x-2.5)*x*x + 1
+	case x < 2:
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	default:
+		return 0
+	}
+}
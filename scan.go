@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Walks a directory for image files according to the scan options of an
+// ImagesPath
+type scanner struct {
+	root           string
+	recursive      bool
+	maxDepth       int // negative means unlimited
+	include        []string
+	exclude        []string
+	followSymlinks bool
+	// caches which files are images. May be nil
+	index *ImageIndex
+	// images in other formats are skipped
+	formats map[string]struct{}
+	// images too small or with the wrong aspect ratio are skipped
+	filter ImageFilter
+	// real paths of directories already walked, to not walk a directory twice
+	// through symlinks pointing back to its parents (or each other)
+	visited map[string]struct{}
+	images  []string
+	// number of images found per format
+	counts map[string]int
+	// files that were skipped and why
+	rejected []Rejection
+}
+
+// A file skipped while scanning a path
+type Rejection struct {
+	Path   string
+	Reason string
+}
+
+func newScanner(p *ImagesPath, root string, index *ImageIndex, filter ImageFilter) *scanner {
+	maxDepth := -1
+	if p.MaxDepth != nil {
+		maxDepth = int(*p.MaxDepth)
+	}
+	allowed := make(map[string]struct{}, len(filter.Formats))
+	for _, format := range filter.Formats {
+		allowed[format] = struct{}{}
+	}
+	return &scanner{
+		root:           root,
+		recursive:      Option(p.Recursive).UnwrapOr(false),
+		maxDepth:       maxDepth,
+		include:        p.Include,
+		exclude:        p.Exclude,
+		followSymlinks: Option(p.FollowSymlinks).UnwrapOr(false),
+		index:          index,
+		formats:        allowed,
+		filter:         filter,
+		visited:        make(map[string]struct{}),
+		images:         make([]string, 0),
+		counts:         make(map[string]int),
+	}
+}
+
+// Walks the directory at dir which is depth levels below the root
+func (s *scanner) walk(dir string, depth int) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if _, seen := s.visited[realDir]; seen {
+		slog.Warn("Skipping directory already walked (symlink loop?)", "dir", dir, "target", realDir)
+		return nil
+	}
+	s.visited[realDir] = struct{}{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	indexed := s.index.walk(dir)
+	defer indexed.commit()
+	for _, entry := range entries {
+		if entry.Name() == SidecarName || isFeedFile(entry.Name()) {
+			continue
+		}
+		full := filepath.Join(dir, entry.Name())
+		rel := s.relative(full)
+		isDir := entry.IsDir()
+		var info os.FileInfo
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err = os.Stat(full)
+			if err != nil {
+				slog.Warn("Skipping broken symlink", "path", full, "error", err)
+				continue
+			}
+			if info.IsDir() && !s.followSymlinks {
+				continue
+			}
+			isDir = info.IsDir()
+		}
+		if isDir {
+			if !s.recursive || (s.maxDepth >= 0 && depth >= s.maxDepth) {
+				continue
+			}
+			if matchesAny(s.exclude, rel) {
+				continue
+			}
+			if err := s.walk(full, depth+1); err != nil {
+				slog.Warn("Skipping directory", "dir", full, "error", err)
+			}
+			continue
+		}
+		if matchesAny(s.exclude, rel) {
+			indexed.keep(entry.Name())
+			s.reject(full, "matches exclude")
+			continue
+		}
+		if len(s.include) > 0 && !matchesAny(s.include, rel) {
+			indexed.keep(entry.Name())
+			s.reject(full, "does not match include")
+			continue
+		}
+		if info == nil {
+			info, err = entry.Info()
+			if err != nil {
+				slog.Warn("Skipping file", "path", full, "error", err)
+				continue
+			}
+		}
+		s.add(full, indexed.entry(entry.Name(), info))
+	}
+	return nil
+}
+
+// Adds the file if it is an image that passes the filter. Otherwise, it is
+// rejected
+func (s *scanner) add(full string, entry IndexEntry) {
+	if entry.Format == "" {
+		s.reject(full, "not an image")
+		return
+	}
+	if _, ok := s.formats[entry.Format]; !ok {
+		s.reject(full, fmt.Sprint(entry.Format, " is not in formats"))
+		return
+	}
+	if reason := s.filter.rejectDimensions(entry.Width, entry.Height); reason != "" {
+		s.reject(full, reason)
+		return
+	}
+	s.images = append(s.images, full)
+	s.counts[entry.Format]++
+}
+
+func (s *scanner) reject(full, reason string) {
+	s.rejected = append(s.rejected, Rejection{Path: full, Reason: reason})
+}
+
+// Adds a single file that is not found by walking a directory (the path
+// itself or a playlist entry) if it is an image in one of the formats
+func (s *scanner) file(full string) {
+	info, err := statFile(full)
+	if err != nil {
+		slog.Warn("Skipping file", "path", full, "error", err)
+		return
+	}
+	if info.IsDir() {
+		slog.Warn("Skipping directory in playlist", "path", full)
+		return
+	}
+	s.add(full, s.index.fileEntry(full, info))
+}
+
+// path relative to the root, always using "/" as separator
+func (s *scanner) relative(p string) string {
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches a "/" separated path relative to the root of an ImagesPath against a
+// glob pattern (case insensitive, like Windows paths).
+//
+// Patterns without a "/" match against the file or directory name only (e.g.
+// "*.png"). Otherwise they match against the whole relative path where "**"
+// matches any number of directories (e.g. "Anime/**/*.png")
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.ToLower(filepath.ToSlash(pattern))
+	rel = strings.ToLower(rel)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// Checks that the pattern can be used by matchGlob
+func ValidateGlob(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("pattern must not be empty")
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	// Windows has no tz database of its own for time.LoadLocation
+	_ "time/tzdata"
+)
+
+// Weekdays as written in ScheduleRule.Days, in the order of time.Weekday
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// A time window in which only some of the paths are used and the default image
+// properties are different. e.g. dark, low opacity images in the evening
+type ScheduleRule struct {
+	// used in logs and `tbg schedule show`. Defaults to the position of the
+	// rule in the schedule
+	Name *string `yaml:"name,omitempty" json:"name,omitempty"`
+	// start of the window as "HH:MM", inclusive
+	From string `yaml:"from" json:"from"`
+	// end of the window as "HH:MM", exclusive. May be before From to cross
+	// midnight. Equal to From means the whole day
+	To string `yaml:"to" json:"to"`
+	// days the window starts on (sun, mon, ..., sat). Every day if empty
+	Days []string `yaml:"days,omitempty" json:"days,omitempty"`
+	// the "path" of each path in the config to use. All of them if empty
+	Paths []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	// used instead of the defaults for paths that do not set their own
+	Alignment *string  `yaml:"alignment,omitempty" json:"alignment,omitempty"`
+	Opacity   *Opacity `yaml:"opacity,omitempty" json:"opacity,omitempty"`
+	Stretch   *string  `yaml:"stretch,omitempty" json:"stretch,omitempty"`
+}
+
+// name of the rule at index i of the schedule
+func (rule *ScheduleRule) NameOrDefault(i int) string {
+	return Option(rule.Name).UnwrapOr(fmt.Sprint("rule ", i+1))
+}
+
+// "HH:MM" to minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s': expected HH:MM (e.g. 18:30)", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func ValidateWeekday(val *string) (*string, error) {
+	if val == nil {
+		return nil, fmt.Errorf("weekday must have a value. got none")
+	}
+	if slices.Contains(Weekdays, *val) {
+		return val, nil
+	}
+	return nil, fmt.Errorf(`invalid value '%s' for weekday: unknown weekday
+%v`, *val, Weekdays)
+}
+
+func (rule *ScheduleRule) startsOn(day time.Weekday) bool {
+	return len(rule.Days) == 0 || slices.Contains(rule.Days, Weekdays[day])
+}
+
+// Start and end of the window that starts on the day of t. The end is on the
+// next day if the window crosses midnight
+func (rule *ScheduleRule) window(t time.Time) (time.Time, time.Time) {
+	from, _ := parseClock(rule.From)
+	to, _ := parseClock(rule.To)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	start := midnight.Add(time.Duration(from) * time.Minute)
+	end := midnight.Add(time.Duration(to) * time.Minute)
+	if to <= from {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// Whether t is in a window of the rule. Returns the end of that window as well
+func (rule *ScheduleRule) activeAt(t time.Time) (bool, time.Time) {
+	// a window that started yesterday may still be going on
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+		if !rule.startsOn(day.Weekday()) {
+			continue
+		}
+		start, end := rule.window(day)
+		if !t.Before(start) && t.Before(end) {
+			return true, end
+		}
+	}
+	return false, time.Time{}
+}
+
+// Start of the next window of the rule after t. Zero if it never starts
+func (rule *ScheduleRule) nextStart(t time.Time) time.Time {
+	for offset := range 8 {
+		day := t.AddDate(0, 0, offset)
+		if !rule.startsOn(day.Weekday()) {
+			continue
+		}
+		if start, _ := rule.window(day); start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// When the rule stops being active if it is active at t. Windows that start
+// right as the previous one ends are followed. Zero if it never stops (e.g.
+// the whole day every day)
+func (rule *ScheduleRule) activeUntil(t time.Time) time.Time {
+	for range 8 {
+		active, end := rule.activeAt(t)
+		if !active {
+			return t
+		}
+		t = end
+	}
+	return time.Time{}
+}
+
+// When the active rules of the schedule change next after t. Zero if they
+// never do
+func (cfg *Config) NextScheduleChange(t time.Time) time.Time {
+	candidates := make([]time.Time, 0)
+	for _, rule := range cfg.Schedule {
+		for offset := -1; offset <= 8; offset++ {
+			day := t.AddDate(0, 0, offset)
+			if !rule.startsOn(day.Weekday()) {
+				continue
+			}
+			start, end := rule.window(day)
+			candidates = append(candidates, start, end)
+		}
+	}
+	slices.SortFunc(candidates, time.Time.Compare)
+	current := cfg.ActiveRules(t)
+	for _, candidate := range candidates {
+		if candidate.After(t) && !slices.Equal(cfg.ActiveRules(candidate), current) {
+			return candidate
+		}
+	}
+	return time.Time{}
+}
+
+// returns the timezone the schedule is evaluated in if set. otherwise, the
+// local timezone
+func (cfg *Config) Location() (*time.Location, error) {
+	if cfg.Timezone == nil || *cfg.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(*cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s': %s", *cfg.Timezone, err)
+	}
+	return loc, nil
+}
+
+// current time in the timezone of the config
+func (cfg *Config) Now() time.Time {
+	loc, err := cfg.Location()
+	if err != nil {
+		loc = time.Local
+	}
+	return time.Now().In(loc)
+}
+
+// Indexes of the rules in the schedule that are active at t
+func (cfg *Config) ActiveRules(t time.Time) []int {
+	active := make([]int, 0)
+	for i, rule := range cfg.Schedule {
+		if ok, _ := rule.activeAt(t); ok {
+			active = append(active, i)
+		}
+	}
+	return active
+}
+
+// What the active rules of the schedule allow
+type ScheduleState struct {
+	// indexes of the active rules
+	Rules []int
+	// whether each path in the config can be used. nil if every path can
+	Paths []bool
+	// defaults of the first active rule that sets them
+	Props ImageProps
+}
+
+// Paths allowed by the rules active at t are the union of the paths of each
+// rule. Every path is allowed if no rule is active or an active rule does not
+// limit the paths
+func (cfg *Config) ScheduleAt(t time.Time) ScheduleState {
+	state := ScheduleState{Rules: cfg.ActiveRules(t)}
+	if len(state.Rules) == 0 {
+		return state
+	}
+	allowed := make([]bool, len(cfg.Paths))
+	limited := true
+	for _, i := range state.Rules {
+		rule := cfg.Schedule[i]
+		state.Props.Alignment = Option(state.Props.Alignment).Or(rule.Alignment).val
+		state.Props.Opacity = Option(state.Props.Opacity).Or(rule.Opacity).val
+		state.Props.Stretch = Option(state.Props.Stretch).Or(rule.Stretch).val
+		if len(rule.Paths) == 0 {
+			limited = false
+			continue
+		}
+		for j, path := range cfg.Paths {
+			if slices.Contains(rule.Paths, path.Path) {
+				allowed[j] = true
+			}
+		}
+	}
+	if limited {
+		state.Paths = allowed
+	}
+	return state
+}
+
+// whether the path at index i of the config can be used
+func (state *ScheduleState) allows(i int) bool {
+	return state.Paths == nil || state.Paths[i]
+}
+
+// names of the rules, comma separated. "none" if empty
+func (cfg *Config) ruleNames(rules []int) string {
+	if len(rules) == 0 {
+		return "none"
+	}
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = cfg.Schedule[rule].NameOrDefault(rule)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validates a rule at index i of the schedule against the paths of the config
+func (cfg *Config) validateRule(i int, rule ScheduleRule) []error {
+	errs := make([]error, 0)
+	name := rule.NameOrDefault(i)
+	if _, err := parseClock(rule.From); err != nil {
+		errs = append(errs, fmt.Errorf("schedule %s from: %s", name, err))
+	}
+	if _, err := parseClock(rule.To); err != nil {
+		errs = append(errs, fmt.Errorf("schedule %s to: %s", name, err))
+	}
+	for _, day := range rule.Days {
+		if _, err := ValidateWeekday(&day); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s days: %s", name, err))
+		}
+	}
+	for _, path := range rule.Paths {
+		if !slices.ContainsFunc(cfg.Paths, func(p ImagesPath) bool { return p.Path == path }) {
+			errs = append(errs, fmt.Errorf("schedule %s paths: '%s' is not in paths", name, path))
+		}
+	}
+	if rule.Alignment != nil {
+		if _, err := ValidateAlignment(rule.Alignment); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s alignment: %s", name, err))
+		}
+	}
+	if rule.Opacity != nil {
+		opacity := fmt.Sprint(*rule.Opacity)
+		if _, err := ValidateOpacity(&opacity); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s opacity: %s", name, err))
+		}
+	}
+	if rule.Stretch != nil {
+		if _, err := ValidateStretch(rule.Stretch); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %s stretch: %s", name, err))
+		}
+	}
+	return errs
+}
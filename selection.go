@@ -0,0 +1,434 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// pick a random path according to the weighting, then a random image
+	// under it
+	RandomSelection string = "random"
+	// show every image across all paths once in a random order before
+	// repeating any of them
+	ShuffleSelection string = "shuffle"
+	// show every image of a path in order. As the global selection, paths are
+	// shown one after the other in the order they are in the config
+	SequentialSelection string = "sequential"
+)
+
+// How the "random" selection weighs paths
+const (
+	// by the weight of each path. Paths are equally likely by default
+	WeightWeighting string = "weight"
+	// by the number of images under each path multiplied by its weight. Every
+	// image is equally likely by default
+	CountWeighting string = "count"
+)
+
+// Orders used by the "sequential" selection
+const (
+	// by file path, case insensitive
+	NameOrder     string = "name"
+	NameDescOrder string = "name-desc"
+	// like name but numbers are compared by value (page2 before page10)
+	NaturalOrder     string = "natural"
+	NaturalDescOrder string = "natural-desc"
+	// by modification time, oldest first
+	MtimeOrder     string = "mtime"
+	MtimeDescOrder string = "mtime-desc"
+)
+
+// Position in the sequence of images of a path
+type SequencePosition struct {
+	// last image shown from the path. Empty to start from the beginning
+	Last string `json:"last"`
+	// index of Last when it was shown. Used to continue from the same spot if
+	// Last was removed
+	Index int `json:"index"`
+}
+
+// Position of the "sequential" selection across all paths
+type Sequence struct {
+	// index of the path in the config currently being shown
+	Path int `json:"path"`
+	// keyed by ImagesPath.Path
+	Positions map[string]SequencePosition `json:"positions"`
+}
+
+// No-repeat selection across all images under all paths. Images not shown
+// yet are drawn at random until every image was shown, which starts a new
+// cycle.
+type ShuffleBag struct {
+	// images already shown in the current cycle. Kept while the images drawn
+	// from change (e.g. a tag filter or a schedule rule restricts them for a
+	// while) so the cycle continues once they change back
+	Shown []string `json:"shown"`
+}
+
+// Selects an image from a path chosen according to the weighting of the
+// config, returning the index of the path as well. The image is chosen
+// according to the selection of the path
+func (tbg *TbgState) weightedImage(filter TagFilter) (int, string, error) {
+	var pathIndex int
+	tags := newTagger()
+	switch tbg.Config.WeightingOrDefault() {
+	case CountWeighting:
+		imagesOf := make([][]string, len(tbg.Config.Paths))
+		weights := make([]float64, len(tbg.Config.Paths))
+		for i, path := range tbg.Config.Paths {
+			if !tbg.Schedule.allows(i) {
+				continue
+			}
+			images, err := tbg.imagesOf(i)
+			if err != nil {
+				slog.Warn("Skipping path", "path", path.Path, "error", err)
+				continue
+			}
+			imagesOf[i] = tags.filter(&path, images, filter)
+			weights[i] = float64(len(imagesOf[i])) * float64(path.WeightOrDefault())
+		}
+		pathIndex = weightedIndex(weights)
+		if pathIndex < 0 {
+			return 0, "", tbg.noImagesError(filter, "Found no image files in any of the paths")
+		}
+		tbg.Images = imagesOf[pathIndex]
+	default:
+		weights := make([]float64, len(tbg.Config.Paths))
+		for i, path := range tbg.Config.Paths {
+			if tbg.Schedule.allows(i) {
+				weights[i] = float64(path.WeightOrDefault())
+			}
+		}
+		if weightedIndex(weights) < 0 {
+			return 0, "", tbg.noImagesError(filter, "No paths allowed by the schedule")
+		}
+		// paths that fail to list images or without images passing the
+		// filter are dropped until one has
+		for {
+			pathIndex = weightedIndex(weights)
+			if pathIndex < 0 {
+				return 0, "", tbg.noImagesError(filter, "Found no image files in any of the paths")
+			}
+			path := &tbg.Config.Paths[pathIndex]
+			images, err := tbg.imagesOf(pathIndex)
+			if err != nil {
+				slog.Warn("Skipping path", "path", path.Path, "error", err)
+				weights[pathIndex] = 0
+				continue
+			}
+			tbg.Images = tags.filter(path, images, filter)
+			if len(tbg.Images) > 0 {
+				break
+			}
+			weights[pathIndex] = 0
+		}
+	}
+	if tbg.Config.Paths[pathIndex].SelectionOrDefault() == SequentialSelection {
+		return pathIndex, tbg.nextInSequence(pathIndex, tbg.Images), nil
+	}
+	return pathIndex, tbg.Images[rand.IntN(len(tbg.Images))], nil
+}
+
+// Images of the path at the index in the config, kept in TbgState.Scanned
+func (tbg *TbgState) imagesOf(pathIndex int) ([]string, error) {
+	path := &tbg.Config.Paths[pathIndex]
+	images, err := path.Images(tbg.Index, tbg.Config.FilterOf(path))
+	tbg.Scanned[pathIndex] = images
+	return images, err
+}
+
+// ErrNoTaggedImages if the filter is not zero, ErrNoFeedImages if a feed may
+// still download images, or ErrNoExecImages if a command may still give
+// images, so the server keeps running. Otherwise, an error with the message
+func (tbg *TbgState) noImagesError(filter TagFilter, msg string) error {
+	if !filter.IsZero() {
+		return ErrNoTaggedImages
+	}
+	if tbg.Config.HasFeeds() {
+		return ErrNoFeedImages
+	}
+	if tbg.Config.HasExecs() {
+		return ErrNoExecImages
+	}
+	return errors.New(msg)
+}
+
+// Random index where each index is as likely as its weight. Returns -1 if all
+// weights are 0
+func weightedIndex(weights []float64) int {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total <= 0 {
+		return -1
+	}
+	target := rand.Float64() * total
+	for i, weight := range weights {
+		if target < weight {
+			return i
+		}
+		target -= weight
+	}
+	// floating point error; fall back to the last index with a weight
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Shows every image of the current path in order before moving on to the next
+// path in the config, returning the index of the path as well. Paths that fail
+// to list images are skipped; it is only an error if all of them fail
+func (tbg *TbgState) sequentialImage(filter TagFilter) (int, string, error) {
+	paths := tbg.Config.Paths
+	tags := newTagger()
+	tbg.Sequence.Path = min(max(tbg.Sequence.Path, 0), len(paths)-1)
+	for range len(paths) + 1 {
+		pathIndex := tbg.Sequence.Path
+		path := paths[pathIndex]
+		if !tbg.Schedule.allows(pathIndex) {
+			tbg.Sequence.Path = (pathIndex + 1) % len(paths)
+			continue
+		}
+		images, err := tbg.imagesOf(pathIndex)
+		if err != nil {
+			slog.Warn("Skipping path", "path", path.Path, "error", err)
+			tbg.Sequence.Path = (pathIndex + 1) % len(paths)
+			continue
+		}
+		images = tags.filter(&path, images, filter)
+		if len(images) == 0 {
+			// not finished; the images are only filtered out for now
+			tbg.Sequence.Path = (pathIndex + 1) % len(paths)
+			continue
+		}
+		tbg.Config.sortImagesOf(&path, images)
+		next := tbg.Sequence.position(path.Path).next(images)
+		if next >= len(images) {
+			slog.Info("Finished sequence", "path", path.Path)
+			delete(tbg.Sequence.Positions, path.Path)
+			tbg.Sequence.Path = (pathIndex + 1) % len(paths)
+			continue
+		}
+		tbg.Images = images
+		tbg.Sequence.Positions[path.Path] = SequencePosition{Last: images[next], Index: next}
+		return pathIndex, images[next], nil
+	}
+	return 0, "", tbg.noImagesError(filter, "Found no image files in any of the paths")
+}
+
+// Next image of the path in its order, starting over after the last one
+func (tbg *TbgState) nextInSequence(pathIndex int, images []string) string {
+	path := tbg.Config.Paths[pathIndex]
+	sorted := slices.Clone(images)
+	tbg.Config.sortImagesOf(&path, sorted)
+	next := tbg.Sequence.position(path.Path).next(sorted)
+	if next >= len(sorted) {
+		slog.Info("Finished sequence, starting over", "path", path.Path)
+		next = 0
+	}
+	tbg.Sequence.Positions[path.Path] = SequencePosition{Last: sorted[next], Index: next}
+	return sorted[next]
+}
+
+func (seq *Sequence) position(path string) SequencePosition {
+	if seq.Positions == nil {
+		seq.Positions = make(map[string]SequencePosition)
+	}
+	return seq.Positions[path]
+}
+
+// Index of the image after the last shown one. Equal to the length of images if
+// the last shown one was the last image
+func (pos SequencePosition) next(images []string) int {
+	if pos.Last == "" {
+		return 0
+	}
+	if i := slices.Index(images, pos.Last); i >= 0 {
+		return i + 1
+	}
+	// the last shown image was removed so the image after it took its place
+	return min(max(pos.Index, 0), len(images))
+}
+
+// Sorts the images of the path in place according to its order. Playlists and
+// commands keep the order they list images in unless the path sets its own
+// order
+func (cfg *Config) sortImagesOf(path *ImagesPath, images []string) {
+	if path.Order == nil {
+		if kind, err := path.Kind(); err == nil && (kind == PlaylistPathKind || kind == ExecPathKind) {
+			return
+		}
+	}
+	sortImages(images, cfg.OrderOf(path))
+}
+
+// Sorts the images in place according to the order
+func sortImages(images []string, order string) {
+	switch order {
+	case NameOrder, NameDescOrder:
+		slices.SortFunc(images, func(a, b string) int {
+			return cmp.Or(cmp.Compare(strings.ToLower(a), strings.ToLower(b)), cmp.Compare(a, b))
+		})
+	case MtimeOrder, MtimeDescOrder:
+		mtimes := make(map[string]time.Time, len(images))
+		for _, image := range images {
+			if info, err := statFile(image); err == nil {
+				mtimes[image] = info.ModTime()
+			}
+		}
+		slices.SortFunc(images, func(a, b string) int {
+			return cmp.Or(mtimes[a].Compare(mtimes[b]), cmp.Compare(a, b))
+		})
+	default: // NaturalOrder, NaturalDescOrder
+		slices.SortFunc(images, func(a, b string) int {
+			return cmp.Or(naturalCompare(a, b), cmp.Compare(a, b))
+		})
+	}
+	if strings.HasSuffix(order, "-desc") {
+		slices.Reverse(images)
+	}
+}
+
+// Compares strings case insensitively where runs of digits are compared by
+// their numeric value: "page2" < "page10"
+func naturalCompare(a, b string) int {
+	ar, br := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	i, j := 0, 0
+	for i < len(ar) && j < len(br) {
+		if unicode.IsDigit(ar[i]) && unicode.IsDigit(br[j]) {
+			si, sj := i, j
+			for i < len(ar) && unicode.IsDigit(ar[i]) {
+				i++
+			}
+			for j < len(br) && unicode.IsDigit(br[j]) {
+				j++
+			}
+			na := strings.TrimLeft(string(ar[si:i]), "0")
+			nb := strings.TrimLeft(string(br[sj:j]), "0")
+			// longer numbers without leading zeroes are bigger so numbers
+			// of any size can be compared without overflowing
+			if c := cmp.Compare(len(na), len(nb)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := cmp.Compare(ar[i], br[j]); c != 0 {
+			return c
+		}
+		i++
+		j++
+	}
+	return cmp.Compare(len(ar)-i, len(br)-j)
+}
+
+// Draws the next image from TbgState.Bag, returning the index of the path it
+// is under as well. Paths that fail to list images are skipped; it is only an
+// error if there are no images at all.
+//
+// Images drawn from paths with the "sequential" selection are replaced by the
+// next image of that path in order so each path keeps its share of the cycle.
+func (tbg *TbgState) shuffledImage(filter TagFilter) (int, string, error) {
+	tags := newTagger()
+	pathOf := make(map[string]int)
+	pool := make([]string, 0)
+	imagesOf := make([][]string, len(tbg.Config.Paths))
+	// whether the pool has every image, so images shown that are not in it
+	// no longer exist
+	complete := filter.IsZero()
+	for i, path := range tbg.Config.Paths {
+		if !tbg.Schedule.allows(i) {
+			complete = false
+			continue
+		}
+		images, err := tbg.imagesOf(i)
+		if err != nil {
+			slog.Warn("Skipping path", "path", path.Path, "error", err)
+			complete = false
+			continue
+		}
+		images = tags.filter(&path, images, filter)
+		imagesOf[i] = images
+		for _, image := range images {
+			if _, exists := pathOf[image]; !exists {
+				pathOf[image] = i
+				pool = append(pool, image)
+			}
+		}
+	}
+	if len(pool) == 0 {
+		return 0, "", tbg.noImagesError(filter, "Found no image files in any of the paths")
+	}
+	tbg.Images = pool
+	if complete {
+		tbg.Bag.keepOnly(pool)
+	}
+	image := tbg.Bag.draw(pool, tbg.CurrentImage)
+	pathIndex := pathOf[image]
+	if tbg.Config.Paths[pathIndex].SelectionOrDefault() == SequentialSelection {
+		image = tbg.nextInSequence(pathIndex, imagesOf[pathIndex])
+	}
+	return pathIndex, image, nil
+}
+
+// Forgets the images shown that are not in the pool
+func (bag *ShuffleBag) keepOnly(pool []string) {
+	inPool := make(map[string]struct{}, len(pool))
+	for _, image := range pool {
+		inPool[image] = struct{}{}
+	}
+	bag.Shown = slices.DeleteFunc(bag.Shown, func(image string) bool {
+		_, ok := inPool[image]
+		return !ok
+	})
+}
+
+// Draws a random image of the pool that was not shown yet in the current
+// cycle. Once every image of the pool was shown, a new cycle starts for the
+// images of the pool, making sure that the last image is not shown twice in
+// a row. Images outside of the pool keep their place in the cycle
+func (bag *ShuffleBag) draw(pool []string, last string) string {
+	shown := make(map[string]struct{}, len(bag.Shown))
+	for _, image := range bag.Shown {
+		shown[image] = struct{}{}
+	}
+	left := make([]string, 0, len(pool))
+	for _, image := range pool {
+		if _, ok := shown[image]; !ok {
+			left = append(left, image)
+		}
+	}
+	if len(left) == 0 {
+		slog.Info("Shown every image, starting a new cycle", "images", len(pool))
+		inPool := make(map[string]struct{}, len(pool))
+		for _, image := range pool {
+			inPool[image] = struct{}{}
+		}
+		bag.Shown = slices.DeleteFunc(bag.Shown, func(image string) bool {
+			_, ok := inPool[image]
+			return ok
+		})
+		left = append(left, pool...)
+		if len(left) > 1 {
+			left = slices.DeleteFunc(left, func(image string) bool {
+				return image == last
+			})
+		}
+	}
+	image := left[rand.IntN(len(left))]
+	bag.Shown = append(bag.Shown, image)
+	return image
+}
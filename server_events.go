@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// What caused an image change
+type ImageChangeTrigger string
+
+const (
+	TickTrigger      ImageChangeTrigger = "tick"
+	NextImageTrigger ImageChangeTrigger = "next-image"
+	SetImageTrigger  ImageChangeTrigger = "set-image"
+
+	PreviousImageTrigger ImageChangeTrigger = "previous-image"
+	ForwardImageTrigger  ImageChangeTrigger = "forward-image"
+)
+
+// whether the image change walked TbgState.History instead of adding to it
+func (t ImageChangeTrigger) IsHistoryNavigation() bool {
+	return t == PreviousImageTrigger || t == ForwardImageTrigger
+}
+
+type ServerEventType string
+
+const (
+	ImageServerEvent    ServerEventType = "image"
+	ErrorServerEvent    ServerEventType = "error"
+	PauseServerEvent    ServerEventType = "pause"
+	ResumeServerEvent   ServerEventType = "resume"
+	ShutdownServerEvent ServerEventType = "shutdown"
+	TagsServerEvent     ServerEventType = "tags"
+)
+
+// Pushed to every subscriber of the /events stream
+type ServerEvent struct {
+	Type ServerEventType `json:"type"`
+	Time time.Time       `json:"time"`
+	// below are only set on image events
+	Image     string             `json:"image,omitempty"`
+	Profile   string             `json:"profile,omitempty"`
+	Alignment string             `json:"alignment,omitempty"`
+	Opacity   *float32           `json:"opacity,omitempty"`
+	Stretch   string             `json:"stretch,omitempty"`
+	Trigger   ImageChangeTrigger `json:"trigger,omitempty"`
+	// only set on error events
+	Error string `json:"error,omitempty"`
+	// only set on tags events. Empty if the active tags were cleared
+	Tags *TagFilter `json:"tags,omitempty"`
+}
+
+// A client of the /events stream
+type Subscriber struct {
+	Events chan ServerEvent
+	// closed by the client once it stopped streaming
+	Done chan struct{}
+}
+
+// Buffer size of each subscriber. Events are dropped for subscribers that are
+// this far behind so a slow client can never block TbgState.eventHandler()
+const subscriberBufferSize = 16
+
+// How long TbgState.closeSubscribers() waits for subscribers to receive the
+// final event before the server exits
+const subscriberCloseTimeout = time.Second
+
+// Sends the event to all subscribers without blocking. Must only be called by
+// TbgState.eventHandler()
+func (tbg *TbgState) publish(evt ServerEvent) {
+	evt.Time = time.Now()
+	for sub := range tbg.Subscribers {
+		select {
+		case sub.Events <- evt:
+		default:
+			slog.Warn("Dropped event for slow subscriber", "type", evt.Type)
+		}
+	}
+}
+
+// Publishes a final event, closes all subscribers, and waits for them to
+// finish streaming. Must only be called by TbgState.eventHandler() right
+// before it returns
+func (tbg *TbgState) closeSubscribers(evt ServerEvent) {
+	tbg.publish(evt)
+	for sub := range tbg.Subscribers {
+		close(sub.Events)
+	}
+	timeout := time.After(subscriberCloseTimeout)
+	for sub := range tbg.Subscribers {
+		select {
+		case <-sub.Done:
+		case <-timeout:
+		}
+		delete(tbg.Subscribers, sub)
+	}
+}
+
+// Streams ServerEvents as Server-Sent Events until the client disconnects or
+// the server shuts down
+func (tbg *TbgState) handleEvents(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Recieved events request")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "events: streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	sub := &Subscriber{
+		Events: make(chan ServerEvent, subscriberBufferSize),
+		Done:   make(chan struct{}),
+	}
+	defer close(sub.Done)
+	select {
+	case tbg.Events.Subscribe <- sub:
+	case <-tbg.Events.Done:
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Info("Events subscriber disconnected")
+			select {
+			case tbg.Events.Unsubscribe <- sub:
+			case <-tbg.Events.Done:
+			}
+			return
+		case evt, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(evt)
+			if err != nil {
+				slog.Error("Failed to marshal event", "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", evt.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Runtime data of TbgState that is restored on TbgState.Start() so restarting
+// the server resumes where it left off
+type PersistedState struct {
+	Image     string  `json:"image,omitempty"`
+	Alignment string  `json:"alignment,omitempty"`
+	Opacity   float32 `json:"opacity,omitempty"`
+	Stretch   string  `json:"stretch,omitempty"`
+
+	History      []HistoryEntry `json:"history,omitempty"`
+	HistoryIndex int            `json:"history_index"`
+
+	Paused          bool          `json:"paused"`
+	PausedRemaining time.Duration `json:"paused_remaining,omitempty"`
+	NextTick        time.Time     `json:"next_tick"`
+
+	Bag      ShuffleBag `json:"bag"`
+	Sequence Sequence   `json:"sequence"`
+
+	ActiveTags TagFilter `json:"active_tags"`
+}
+
+// The state file is in the same directory as the config (where tbg.log is).
+// It is per port so multiple servers sharing a config do not overwrite each
+// other's state
+func StatePath(configPath string, port uint16) string {
+	return filepath.Join(filepath.Dir(configPath), fmt.Sprintf("state_%d.json", port))
+}
+
+// Writes the runtime data to the state file. Failing to do so is only logged
+// since the server can keep running without it. Must only be called by
+// TbgState.eventHandler()
+func (tbg *TbgState) saveState() {
+	state := PersistedState{
+		Image:           tbg.CurrentImage,
+		Alignment:       tbg.CurrentAlignment,
+		Opacity:         tbg.CurrentOpacity,
+		Stretch:         tbg.CurrentStretch,
+		History:         tbg.History,
+		HistoryIndex:    tbg.HistoryIndex,
+		Paused:          tbg.Paused,
+		PausedRemaining: tbg.PausedRemaining,
+		NextTick:        tbg.NextTick,
+		Bag:             tbg.Bag,
+		Sequence:        tbg.Sequence,
+		ActiveTags:      tbg.ActiveTags,
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		slog.Warn("Failed to marshal state", "error", err)
+		return
+	}
+	// write to a temporary file first so a crash mid-write never leaves a
+	// corrupted state file behind
+	tmpPath := tbg.StatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0666); err != nil {
+		slog.Warn("Failed to write state", "path", tmpPath, "error", err)
+		return
+	}
+	if err := os.Rename(tmpPath, tbg.StatePath); err != nil {
+		slog.Warn("Failed to write state", "path", tbg.StatePath, "error", err)
+	}
+}
+
+// Restores the runtime data saved by TbgState.saveState(). A missing or
+// unreadable state file means starting from scratch. Must be called before
+// the TbgState goroutines are started
+func (tbg *TbgState) loadState() {
+	data, err := os.ReadFile(tbg.StatePath)
+	if os.IsNotExist(err) {
+		slog.Info("No state to restore", "path", tbg.StatePath)
+		return
+	} else if err != nil {
+		slog.Warn("Failed to read state", "path", tbg.StatePath, "error", err)
+		return
+	}
+	var state PersistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		slog.Warn("Failed to unmarshal state", "path", tbg.StatePath, "error", err)
+		return
+	}
+	if state.Image != "" {
+		tbg.CurrentImage = state.Image
+		tbg.CurrentAlignment = state.Alignment
+		tbg.CurrentOpacity = state.Opacity
+		tbg.CurrentStretch = state.Stretch
+	}
+	if len(state.History) > HistorySize {
+		offset := len(state.History) - HistorySize
+		state.History = state.History[offset:]
+		state.HistoryIndex -= offset
+	}
+	tbg.History = state.History
+	tbg.HistoryIndex = min(max(state.HistoryIndex, 0), max(len(tbg.History)-1, 0))
+	tbg.Paused = state.Paused
+	tbg.PausedRemaining = min(max(state.PausedRemaining, 0), tbg.maxWait())
+	// images of the bag that no longer exist are forgotten on the next draw
+	// from every image
+	tbg.Bag = state.Bag
+	tbg.Sequence = state.Sequence
+	tbg.ActiveTags = state.ActiveTags
+	// an overdue tick (e.g. the machine was off) waits the full interval
+	// instead of immediately changing the image on start
+	if state.NextTick.After(time.Now()) && time.Until(state.NextTick) <= tbg.maxWait() {
+		tbg.NextTick = state.NextTick
+	}
+	slog.Info("Restored state",
+		"path", tbg.StatePath,
+		"image", tbg.CurrentImage,
+		"history", len(tbg.History),
+		"paused", tbg.Paused,
+		"active-tags", tbg.ActiveTags.String(),
+	)
+}
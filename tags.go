@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the file in a directory of images that sets properties of the
+// images in it, keyed by file name:
+//
+//	sunset.png:
+//	  tags: [calm, evening]
+const SidecarName = ".tbg.yml"
+
+// Properties of an image set in a sidecar
+type SidecarEntry struct {
+	Tags []string `yaml:"tags,omitempty"`
+	// where the "smart" crop keeps the image centered on. See ImagesPath.Crop
+	Focus *FocalPoint `yaml:"focus,omitempty"`
+}
+
+// Sidecar of a directory keyed by the file name of each image
+type Sidecar map[string]SidecarEntry
+
+// Reads the sidecar of the directory, which can be in an archive. Empty if the
+// directory has none
+func ReadSidecar(dir string) (Sidecar, error) {
+	handle, err := openFile(filepath.Join(dir, SidecarName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Sidecar{}, nil
+	}
+	var data []byte
+	if err == nil {
+		data, err = io.ReadAll(handle)
+		handle.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %s", filepath.Join(dir, SidecarName), err)
+	}
+	sidecar := make(Sidecar)
+	if err := yaml.Unmarshal(data, &sidecar); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", filepath.Join(dir, SidecarName), err)
+	}
+	return sidecar, nil
+}
+
+// Which images to use by their tags. Tags are compared case insensitively
+type TagFilter struct {
+	// images must have at least one of these tags. Any image if empty
+	Tags []string `json:"tags,omitempty"`
+	// images must have none of these tags
+	ExcludeTags []string `json:"exclude_tags,omitempty"`
+}
+
+// Returned when no image matches the tag filter. Unlike other selection
+// errors, this does not stop the server
+var ErrNoTaggedImages = errors.New("No images match the tags")
+
+// whether the filter lets every image through
+func (filter TagFilter) IsZero() bool {
+	return len(filter.Tags) == 0 && len(filter.ExcludeTags) == 0
+}
+
+// Checks the tags of a filter sent in a request body. See ValidateTag()
+func (filter TagFilter) Validate() error {
+	for _, tag := range slices.Concat(filter.Tags, filter.ExcludeTags) {
+		if _, err := ValidateTag(&tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// whether an image with the tags passes the filter
+func (filter TagFilter) matches(tags []string) bool {
+	has := func(tag string) bool {
+		return slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	}
+	if slices.ContainsFunc(filter.ExcludeTags, has) {
+		return false
+	}
+	return len(filter.Tags) == 0 || slices.ContainsFunc(filter.Tags, has)
+}
+
+// e.g. "calm, focus (excluding fun)". "none" if the filter is zero
+func (filter TagFilter) String() string {
+	if filter.IsZero() {
+		return "none"
+	}
+	var ret strings.Builder
+	if len(filter.Tags) > 0 {
+		ret.WriteString(strings.Join(filter.Tags, ", "))
+	} else {
+		ret.WriteString("any")
+	}
+	if len(filter.ExcludeTags) > 0 {
+		fmt.Fprint(&ret, " (excluding ", strings.Join(filter.ExcludeTags, ", "), ")")
+	}
+	return ret.String()
+}
+
+func ValidateTag(val *string) (*string, error) {
+	if val == nil || *val == "" {
+		return nil, fmt.Errorf("tag must not be empty")
+	}
+	if strings.ContainsFunc(*val, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		return nil, fmt.Errorf("invalid tag '%s': tags cannot have commas or spaces", *val)
+	}
+	return val, nil
+}
+
+// Comma separated tags passed through --tag or --exclude-tag
+func ValidateTags(flag FlagType, val *string) ([]string, error) {
+	if val == nil || *val == "" {
+		return nil, fmt.Errorf("%s must have an argument. got none", flag)
+	}
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(*val, ",") {
+		tag = strings.TrimSpace(tag)
+		if _, err := ValidateTag(&tag); err != nil {
+			return nil, fmt.Errorf("invalid arg '%s' for %s: %s", *val, flag, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Sidecars keyed by directory so each is read once
+type sidecarCache map[string]Sidecar
+
+// Entry of the image in the sidecar of its directory. Empty if it has none
+func (sidecars sidecarCache) entryOf(image string) SidecarEntry {
+	image = filepath.FromSlash(image)
+	dir := filepath.Dir(image)
+	sidecar, ok := sidecars[dir]
+	if !ok {
+		var err error
+		sidecar, err = ReadSidecar(dir)
+		if err != nil {
+			slog.Warn("Ignoring sidecar", "error", err)
+		}
+		sidecars[dir] = sidecar
+	}
+	return sidecar[filepath.Base(image)]
+}
+
+// Tags of the images under a path: the tags of the path and of each image in
+// the sidecar of its directory. Sidecars are read once per tagger
+type tagger struct {
+	sidecars sidecarCache
+}
+
+func newTagger() *tagger {
+	return &tagger{sidecars: make(sidecarCache)}
+}
+
+func (t *tagger) tagsOf(path *ImagesPath, image string) []string {
+	return slices.Concat(path.Tags, t.sidecars.entryOf(image).Tags)
+}
+
+// Images of the path that pass the filter
+func (t *tagger) filter(path *ImagesPath, images []string, filter TagFilter) []string {
+	if filter.IsZero() {
+		return images
+	}
+	return slices.DeleteFunc(slices.Clone(images), func(image string) bool {
+		return !filter.matches(t.tagsOf(path, image))
+	})
+}
+
+// Number of images with each tag across all paths, ignoring the schedule.
+// The images are the ones found the last time each path was scanned (see
+// TbgState.Scanned) so the paths are not scanned again
+func (tbg *TbgState) tagCounts() map[string]int {
+	counts := make(map[string]int)
+	t := newTagger()
+	for i, path := range tbg.Config.Paths {
+		for _, image := range tbg.Scanned[i] {
+			seen := make(map[string]struct{})
+			for _, tag := range t.tagsOf(&path, image) {
+				tag = strings.ToLower(tag)
+				if _, ok := seen[tag]; !ok {
+					seen[tag] = struct{}{}
+					counts[tag]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// Sets the tags that restrict which images are used until cleared with an
+// empty filter
+func (tbg *TbgState) setActiveTags(filter TagFilter) {
+	tbg.ActiveTags = filter
+	slog.Info("Changed active tags",
+		"tags", filter.Tags,
+		"exclude-tags", filter.ExcludeTags,
+	)
+	tbg.saveState()
+	tbg.publish(ServerEvent{Type: TagsServerEvent, Tags: &filter})
+	tbg.runExecs(filter)
+}
+
+// Active tags and how many images have each tag, served through /tags
+func (tbg *TbgState) tags() TagsResponseBody {
+	return TagsResponseBody{Active: tbg.ActiveTags, Counts: tbg.tagCounts()}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"time"
 
@@ -20,18 +22,27 @@ type TbgState struct {
 	//
 	// Dynamically generated by ImagesPath.images() in TbgState.updateCurrentPathState()
 	Images []string
+	// images under each path found the last time it was scanned, in the order
+	// of the paths in the config. nil for paths that failed. Used to count
+	// tags without scanning every path again
+	Scanned [][]string
 	// slice of paths defined in the tbg config
 	Paths []ImagesPath
 	// tbg config where paths, interval, and profile information is from
 	Config *Config
 	// Used for logging the config with the current execution state
 	ConfigPath string
+	// where runtime data is persisted across restarts. See StatePath()
+	StatePath string
+	// caches which files under the paths are images so they are not opened
+	// on every image change. Only accessed by TbgState.eventHandler()
+	Index *ImageIndex
 	// passed through --alignment flag. will override all alignment values,
 	// regardless of what is in the config
 	OverrideAlignment *string
 	// passed through --opacity flag. will override all opacity values,
 	// regardless of what is in the config
-	OverrideOpacity *float32
+	OverrideOpacity *Opacity
 	// passed through --stretch flag. will override all stretch values,
 	// regardless of what is in the config
 	OverrideStretch *string
@@ -40,6 +51,36 @@ type TbgState struct {
 	// Used to call the WTSettings.Write() method to update WT's settings.json
 	// with the current background image
 	Settings *WTSettings
+	// image currently set as the background image along with its properties.
+	// Only updated by TbgState.setImage() and served through /status
+	CurrentImage     string
+	CurrentAlignment string
+	CurrentOpacity   float32
+	CurrentStretch   string
+	// clients of the /events stream. Only accessed by TbgState.eventHandler()
+	Subscribers map[*Subscriber]struct{}
+	// used by the "shuffle" selection to not repeat images
+	Bag ShuffleBag
+	// used by the "sequential" selection to remember where each path is at
+	Sequence Sequence
+	// rules of the schedule active at the last image change, and what they
+	// allow. Updated by TbgState.randomImage()
+	Schedule ScheduleState
+	// restricts which images are used until cleared. Set through /tags
+	ActiveTags TagFilter
+	// images set through TbgState.setImage(), oldest first. Bounded by
+	// HistorySize
+	History []HistoryEntry
+	// position of the current image in History
+	HistoryIndex int
+	// when TbgState.imageUpdateTicker() will emit the next NextImage event.
+	// Only updated by TbgState.resetTicker(), TbgState.pause(), and
+	// TbgState.resume()
+	NextTick time.Time
+	// whether image changes through TbgState.imageUpdateTicker() are paused
+	Paused bool
+	// time left until the next tick when the ticker was paused
+	PausedRemaining time.Duration
 }
 
 func (tbg *TbgState) String() string {
@@ -52,9 +93,29 @@ func (tbg *TbgState) String() string {
 
 // Events for TbgState goroutines to communicate with each other
 type TbgEvents struct {
+	// stops TbgState.eventHandler()
+	Quit chan struct{}
+	// closed once TbgState.eventHandler() returns, whether it was stopped or
+	// failed, so nothing waits on it anymore
 	Done      chan struct{}
 	NextImage chan NextImageEvent
 	SetImage  chan SetImageEvent
+	Status    chan StatusEvent
+	Pause     chan struct{}
+	Resume    chan struct{}
+	// walk TbgState.History. The error of the image change is sent back
+	// through the passed in channel
+	PreviousImage chan chan error
+	ForwardImage  chan chan error
+	History       chan HistoryEvent
+	// query or change TbgState.ActiveTags
+	Tags chan TagsEvent
+	// tells TbgState.imageUpdateTicker() when to emit the next NextImage
+	// event. A zero time stops the ticker until the next reschedule
+	Reschedule chan time.Time
+	// register and unregister clients of the /events stream
+	Subscribe   chan *Subscriber
+	Unsubscribe chan *Subscriber
 	// all TbgState errors must be routed here. The only method that's allowed
 	// to return an error is TbgState.eventHandler() which handles the errors
 	// as well
@@ -62,25 +123,48 @@ type TbgEvents struct {
 }
 
 type NextImageEvent struct {
+	Trigger   ImageChangeTrigger
 	Alignment *string
-	Opacity   *float32
+	Opacity   *Opacity
 	Stretch   *string
+	// used instead of TbgState.ActiveTags if not zero
+	Filter TagFilter
+	// if not nil, the error of the image change is sent back through it. nil
+	// if the image was changed
+	Response chan error
+}
+
+// Sets TbgState.ActiveTags if Set is not nil (an empty filter clears them),
+// then sends back the active tags through Response
+type TagsEvent struct {
+	Set      *TagFilter
+	Response chan TagsResponseBody
+}
+
+// Asks the event handler for a snapshot of the current state, which it sends
+// back through Response
+type StatusEvent struct {
+	Response chan StatusResponseBody
 }
 
 type SetImageEvent struct {
 	Path      string
 	Alignment *string
-	Opacity   *float32
+	Opacity   *Opacity
 	Stretch   *string
+	// the error of the image change is sent back through it. nil if the image
+	// was changed
+	Response chan error
 }
 
-func NewTbgState(config *Config, configPath string, alignment *string, opacity *float32, stretch *string) (*TbgState, error) {
+func NewTbgState(config *Config, configPath string, alignment *string, opacity *Opacity, stretch *string) (*TbgState, error) {
 	wtSettings, err := NewWTSettings()
 	if err != nil {
 		return nil, err
 	}
 	return &TbgState{
 		Images:            make([]string, 2),
+		Scanned:           make([][]string, len(config.Paths)),
 		Paths:             config.Paths,
 		Config:            config,
 		ConfigPath:        configPath,
@@ -88,12 +172,36 @@ func NewTbgState(config *Config, configPath string, alignment *string, opacity *
 		OverrideOpacity:   opacity,
 		OverrideStretch:   stretch,
 		Events: &TbgEvents{
+			Quit:      make(chan struct{}),
 			Done:      make(chan struct{}),
 			NextImage: make(chan NextImageEvent),
 			SetImage:  make(chan SetImageEvent),
+			Status:    make(chan StatusEvent),
+			Pause:     make(chan struct{}),
+			Resume:    make(chan struct{}),
 			Error:     make(chan error),
+
+			PreviousImage: make(chan chan error),
+			ForwardImage:  make(chan chan error),
+			History:       make(chan HistoryEvent),
+			Tags:          make(chan TagsEvent),
+
+			Reschedule: make(chan time.Time),
+
+			Subscribe:   make(chan *Subscriber),
+			Unsubscribe: make(chan *Subscriber),
 		},
-		Settings: wtSettings,
+		Subscribers:      make(map[*Subscriber]struct{}),
+		Settings:         wtSettings,
+		CurrentAlignment: Option(alignment).UnwrapOr(DefaultAlignment),
+		CurrentOpacity: func() float32 {
+			// "auto" is only known once an image is set
+			if opacity == nil || opacity.IsAuto() {
+				return DefaultOpacity
+			}
+			return float32(*opacity)
+		}(),
+		CurrentStretch: Option(stretch).UnwrapOr(DefaultStretch),
 	}, nil
 }
 
@@ -126,32 +234,188 @@ func (tbg *TbgState) Start() error {
 				if path.Stretch != nil {
 					entry["stretch"] = path.Stretch
 				}
+				if path.Selection != nil {
+					entry["selection"] = path.Selection
+				}
+				if path.Order != nil {
+					entry["order"] = path.Order
+				}
+				entry["weight"] = path.WeightOrDefault()
+				if path.Recursive != nil {
+					entry["recursive"] = path.Recursive
+				}
+				if path.MaxDepth != nil {
+					entry["max_depth"] = path.MaxDepth
+				}
+				if len(path.Include) > 0 {
+					entry["include"] = path.Include
+				}
+				if len(path.Exclude) > 0 {
+					entry["exclude"] = path.Exclude
+				}
+				if path.FollowSymlinks != nil {
+					entry["follow_symlinks"] = path.FollowSymlinks
+				}
+				if len(path.Formats) > 0 {
+					entry["formats"] = path.Formats
+				}
+				if path.Interval != nil {
+					entry["interval"] = path.Interval.String()
+				}
+				if len(path.Tags) > 0 {
+					entry["tags"] = path.Tags
+				}
+				if len(path.Effects) > 0 {
+					entry["effects"] = path.Effects.String()
+				}
+				if path.Crop != nil {
+					entry["crop"] = path.Crop
+				}
+				if path.Focus != nil {
+					entry["focus"] = path.Focus.String()
+				}
+				if path.MaxDimensions != nil {
+					entry["max_dimensions"] = path.MaxDimensions.String()
+				}
+				if path.Feed != nil {
+					entry["feed"] = path.Feed
+					entry["refresh"] = path.RefreshOrDefault().String()
+					entry["cache_size"] = fmt.Sprint(Option(path.CacheSize).UnwrapOr(DefaultFeedCacheSize), " MB")
+				}
+				if path.Exec != nil {
+					entry["exec"] = path.Exec.String()
+					entry["timeout"] = path.TimeoutOrDefault().String()
+				}
+				if path.MinWidth != nil {
+					entry["min_width"] = path.MinWidth
+				}
+				if path.MinHeight != nil {
+					entry["min_height"] = path.MinHeight
+				}
+				if path.AspectRatio != nil {
+					entry["aspect_ratio"] = path.AspectRatio.String()
+				}
 				ret[i] = entry
 			}
 			return ret
 		}(),
-		"interval", tbg.Config.IntervalOrDefault(),
+		"interval", tbg.Config.IntervalOrDefault().String(),
+		"jitter", tbg.Config.JitterOrDefault().String(),
 		"port", tbg.Config.PortOrDefault(),
 		"profile", tbg.Config.ProfileOrDefault(),
+		"selection", tbg.Config.SelectionOrDefault(),
+		"order", tbg.Config.OrderOrDefault(),
+		"weighting", tbg.Config.WeightingOrDefault(),
+		"formats", tbg.Config.FormatsOrDefault(),
+		"min_width", Option(tbg.Config.MinWidth).UnwrapOr(0),
+		"min_height", Option(tbg.Config.MinHeight).UnwrapOr(0),
+		"aspect_ratio", func() string {
+			if tbg.Config.AspectRatio != nil {
+				return tbg.Config.AspectRatio.String()
+			}
+			return "any"
+		}(),
+		"max_dimensions", func() string {
+			if tbg.Config.MaxDimensions != nil && !tbg.Config.MaxDimensions.IsZero() {
+				return tbg.Config.MaxDimensions.String()
+			}
+			return "none"
+		}(),
+		"archive_cache_size", fmt.Sprint(Option(tbg.Config.ArchiveCacheSize).UnwrapOr(DefaultArchiveCacheSize), " MB"),
+		"timezone", Option(tbg.Config.Timezone).UnwrapOr("Local"),
+		"schedule", tbg.Config.Schedule,
 	)
-	go tbg.imageUpdateTicker()
+	tbg.StatePath = StatePath(tbg.ConfigPath, tbg.Config.PortOrDefault())
+	tbg.Index = LoadImageIndex(IndexPath(tbg.ConfigPath))
+	tbg.logImages()
+	tbg.loadState()
+	// after restoring so the interval of the restored image is used
+	if tbg.NextTick.IsZero() {
+		tbg.NextTick = tbg.nextTick(time.Now())
+	}
+	if tbg.Paused {
+		go tbg.imageUpdateTicker(time.Time{})
+	} else {
+		go tbg.imageUpdateTicker(tbg.NextTick)
+	}
+	for _, path := range tbg.Config.Paths {
+		if path.Feed != nil {
+			go tbg.feedRefresher(path)
+		}
+	}
+	// after restoring so the commands get the current image and tags
+	tbg.runExecs(tbg.ActiveTags)
 	go tbg.startServer()
 	return tbg.eventHandler()
 }
 
-// Creates a ticker that emits a NextImage Event every *interval* seconds where
-// interval is defined in the tbg config
-func (tbg *TbgState) imageUpdateTicker() {
-	ticker := time.Tick(time.Duration(tbg.Config.IntervalOrDefault()) * time.Second)
+// Scans every path once, logging the number of images per format so it is
+// clear which images are used. This fills the index as well so the first image
+// change does not have to
+func (tbg *TbgState) logImages() {
+	total := 0
+	formats := make(map[string]int)
+	paths := make([]map[string]any, 0, len(tbg.Config.Paths))
+	for i, path := range tbg.Config.Paths {
+		images, counts, err := path.ImagesByFormat(tbg.Index, tbg.Config.FilterOf(&path))
+		tbg.Scanned[i] = images
+		if err != nil {
+			slog.Warn("Skipping path", "path", path.Path, "error", err)
+			continue
+		}
+		total += len(images)
+		for format, count := range counts {
+			formats[format] += count
+		}
+		paths = append(paths, map[string]any{
+			"path":    path.Path,
+			"images":  len(images),
+			"formats": counts,
+		})
+	}
+	slog.Info("Found images", "images", total, "formats", formats, "paths", paths)
+	if err := tbg.Index.Save(); err != nil {
+		slog.Warn("Failed to save image index", "error", err)
+	}
+}
+
+// Emits a NextImage Event once the deadline set through
+// TbgState.Events.Reschedule is reached. The ticker then waits for
+// TbgState.eventHandler() to reschedule it, which it does after every image
+// change so manual changes restart the countdown as well.
+//
+// Starts stopped if passed in a zero time
+func (tbg *TbgState) imageUpdateTicker(next time.Time) {
+	timer := time.NewTimer(time.Until(next))
+	tick := timer.C
+	if next.IsZero() {
+		timer.Stop()
+		tick = nil
+	}
+	// only non-nil while a tick is waiting to be received by the event handler
+	var pending chan NextImageEvent
 	for {
 		select {
-		case <-ticker:
-			slog.Info("Image change tick")
-			tbg.Events.NextImage <- NextImageEvent{
-				Alignment: nil,
-				Opacity:   nil,
-				Stretch:   nil,
+		case next := <-tbg.Events.Reschedule:
+			timer.Stop()
+			pending = nil
+			if next.IsZero() {
+				tick = nil
+			} else {
+				timer.Reset(time.Until(next))
+				tick = timer.C
 			}
+		case <-tick:
+			slog.Info("Image change tick")
+			tick = nil
+			pending = tbg.Events.NextImage
+		case pending <- NextImageEvent{
+			Trigger:   TickTrigger,
+			Alignment: nil,
+			Opacity:   nil,
+			Stretch:   nil,
+		}:
+			pending = nil
 		}
 	}
 }
@@ -175,10 +439,30 @@ func (tbg *TbgState) startServer() {
 		if reqBody.Stretch != nil {
 			slog.Info("stretch", "value", *reqBody.Stretch)
 		}
-		tbg.Events.NextImage <- NextImageEvent{
+		if len(reqBody.Tags) > 0 {
+			slog.Info("tags", "value", reqBody.Tags)
+		}
+		if len(reqBody.ExcludeTags) > 0 {
+			slog.Info("exclude-tags", "value", reqBody.ExcludeTags)
+		}
+		filter := TagFilter{Tags: reqBody.Tags, ExcludeTags: reqBody.ExcludeTags}
+		if err := filter.Validate(); err != nil {
+			slog.Warn("Rejected next-image request", "error", err)
+			http.Error(w, fmt.Sprint("next-image: ", err), http.StatusBadRequest)
+			return
+		}
+		evt := NextImageEvent{
+			Trigger:   NextImageTrigger,
 			Alignment: reqBody.Alignment,
 			Opacity:   reqBody.Opacity,
 			Stretch:   reqBody.Stretch,
+			Filter:    filter,
+			Response:  make(chan error),
+		}
+		tbg.Events.NextImage <- evt
+		if err := <-evt.Response; err != nil {
+			http.Error(w, fmt.Sprint("next-image: ", err), http.StatusNotFound)
+			return
 		}
 		fmt.Fprint(w, "next-image: changed image successfully")
 	})
@@ -201,30 +485,125 @@ func (tbg *TbgState) startServer() {
 		if reqBody.Stretch != nil {
 			slog.Info("Stretch", "value", *reqBody.Stretch)
 		}
-		tbg.Events.SetImage <- SetImageEvent{
+		evt := SetImageEvent{
 			Path:      reqBody.Path,
 			Alignment: reqBody.Alignment,
 			Opacity:   reqBody.Opacity,
 			Stretch:   reqBody.Stretch,
+			Response:  make(chan error),
+		}
+		tbg.Events.SetImage <- evt
+		if err := <-evt.Response; err != nil {
+			http.Error(w, fmt.Sprint("set-image: ", err), http.StatusUnprocessableEntity)
+			return
 		}
 		fmt.Fprint(w, "set-image: changed image successfully")
 	})
 
+	http.HandleFunc("GET /status", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved status request")
+		evt := StatusEvent{Response: make(chan StatusResponseBody)}
+		tbg.Events.Status <- evt
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(<-evt.Response); err != nil {
+			tbg.Events.Error <- fmt.Errorf("Failed to encode response body: %s", err)
+		}
+	})
+
+	http.HandleFunc("GET /events", tbg.handleEvents)
+
+	http.HandleFunc("POST /previous-image", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved previous-image request")
+		response := make(chan error)
+		tbg.Events.PreviousImage <- response
+		if err := <-response; err != nil {
+			http.Error(w, fmt.Sprint("previous-image: ", err), http.StatusUnprocessableEntity)
+			return
+		}
+		fmt.Fprint(w, "previous-image: changed image successfully")
+	})
+
+	http.HandleFunc("POST /forward-image", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved forward-image request")
+		response := make(chan error)
+		tbg.Events.ForwardImage <- response
+		if err := <-response; err != nil {
+			http.Error(w, fmt.Sprint("forward-image: ", err), http.StatusUnprocessableEntity)
+			return
+		}
+		fmt.Fprint(w, "forward-image: changed image successfully")
+	})
+
+	http.HandleFunc("GET /history", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved history request")
+		evt := HistoryEvent{Response: make(chan HistoryResponseBody)}
+		tbg.Events.History <- evt
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(<-evt.Response); err != nil {
+			tbg.Events.Error <- fmt.Errorf("Failed to encode response body: %s", err)
+		}
+	})
+
+	http.HandleFunc("GET /tags", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved tags request")
+		evt := TagsEvent{Response: make(chan TagsResponseBody)}
+		tbg.Events.Tags <- evt
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(<-evt.Response); err != nil {
+			tbg.Events.Error <- fmt.Errorf("Failed to encode response body: %s", err)
+		}
+	})
+
+	http.HandleFunc("POST /tags", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Recieved tags request")
+		var reqBody TagFilter
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			tbg.Events.Error <- fmt.Errorf("Failed to decode request body: %s", err)
+			return
+		}
+		if err := reqBody.Validate(); err != nil {
+			slog.Warn("Rejected tags request", "error", err)
+			http.Error(w, fmt.Sprint("tags: ", err), http.StatusBadRequest)
+			return
+		}
+		evt := TagsEvent{Set: &reqBody, Response: make(chan TagsResponseBody)}
+		tbg.Events.Tags <- evt
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(<-evt.Response); err != nil {
+			tbg.Events.Error <- fmt.Errorf("Failed to encode response body: %s", err)
+		}
+	})
+
+	http.HandleFunc("POST /pause", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved pause request")
+		tbg.Events.Pause <- struct{}{}
+		fmt.Fprint(w, "pause: paused image changes successfully")
+	})
+
+	http.HandleFunc("POST /resume", func(w http.ResponseWriter, _ *http.Request) {
+		slog.Info("Recieved resume request")
+		tbg.Events.Resume <- struct{}{}
+		fmt.Fprint(w, "resume: resumed image changes successfully")
+	})
+
 	http.HandleFunc("POST /quit", func(w http.ResponseWriter, _ *http.Request) {
 		slog.Info("Recieved quit request")
 		fmt.Fprint(w, "quit: stopped server successfully. Goodbye!")
-		close(tbg.Events.Done)
+		select {
+		case tbg.Events.Quit <- struct{}{}:
+		case <-tbg.Events.Done:
+		}
 	})
 
 	tbgPort := ":" + strconv.FormatUint(uint64(tbg.Config.PortOrDefault()), 10)
 	slog.Info("Starting server...",
-		"interval", tbg.Config.IntervalOrDefault(),
+		"interval", tbg.Config.IntervalOrDefault().String(),
 		"port", tbgPort,
 		"profile", tbg.Config.ProfileOrDefault(),
 		"override-alignment", Option(tbg.OverrideAlignment).UnwrapOr("no override"),
 		"override-opacity", func() string {
 			if tbg.OverrideOpacity != nil {
-				return strconv.FormatFloat(float64(*tbg.OverrideOpacity), 'f', -1, 32)
+				return tbg.OverrideOpacity.String()
 			}
 			return "no override"
 		}(),
@@ -237,59 +616,259 @@ func (tbg *TbgState) startServer() {
 }
 
 // Handles events emitted by various TbgState methods.
-func (tbg *TbgState) eventHandler() error {
+//
+// Subscribers of the /events stream are notified with either an error or a
+// shutdown event once this returns. The runtime data is saved as well
+func (tbg *TbgState) eventHandler() (err error) {
+	defer close(tbg.Events.Done)
+	defer func() {
+		tbg.saveState()
+		if err != nil {
+			tbg.closeSubscribers(ServerEvent{Type: ErrorServerEvent, Error: err.Error()})
+		} else {
+			tbg.closeSubscribers(ServerEvent{Type: ShutdownServerEvent})
+		}
+	}()
 	for {
 		select {
-		case <-tbg.Events.Done:
+		case <-tbg.Events.Quit:
 			slog.Info("Goodbye!")
 			return nil
 		case err := <-tbg.Events.Error:
 			return err
 		case evt := <-tbg.Events.NextImage:
-			if err := tbg.changeToRandomImage(evt.Alignment, evt.Opacity, evt.Stretch); err != nil {
+			filter := tbg.ActiveTags
+			if !evt.Filter.IsZero() {
+				filter = evt.Filter
+			}
+			err := tbg.changeToRandomImage(evt.Trigger, filter, evt.Alignment, evt.Opacity, evt.Stretch)
+			if errors.Is(err, ErrNoTaggedImages) ||
+				errors.Is(err, ErrNoFeedImages) ||
+				errors.Is(err, ErrNoExecImages) ||
+				errors.Is(err, ErrExtractImage) {
+				// keep the current image. Its countdown only starts over if it
+				// ran out, since the ticker waits to be rescheduled
+				slog.Warn("Skipped image change", "error", err, "tags", filter.String())
+				if evt.Trigger == TickTrigger {
+					tbg.resetTicker()
+				}
+				tbg.runExecs(tbg.ActiveTags)
+			} else if err != nil {
 				return err
 			}
+			if evt.Response != nil {
+				evt.Response <- err
+			}
 		case evt := <-tbg.Events.SetImage:
-			err := tbg.setImage(
+			alignment, stretch := tbg.resolveLayout(
 				evt.Path,
 				Option(evt.Alignment).UnwrapOr(DefaultAlignment),
-				Option(evt.Opacity).UnwrapOr(DefaultOpacity),
 				Option(evt.Stretch).UnwrapOr(DefaultStretch),
 			)
-			if err != nil {
+			err := tbg.setImage(
+				SetImageTrigger,
+				evt.Path,
+				alignment,
+				Option(evt.Opacity).Or(tbg.Config.Opacity).UnwrapOr(Opacity(DefaultOpacity)),
+				stretch,
+			)
+			if err != nil && !errors.Is(err, ErrExtractImage) {
+				return err
+			}
+			evt.Response <- err
+		case evt := <-tbg.Events.Status:
+			evt.Response <- tbg.status()
+		case response := <-tbg.Events.PreviousImage:
+			err := tbg.previousImage()
+			if err != nil && !errors.Is(err, ErrExtractImage) {
 				return err
 			}
+			response <- err
+		case response := <-tbg.Events.ForwardImage:
+			err := tbg.forwardImage()
+			if err != nil && !errors.Is(err, ErrExtractImage) {
+				return err
+			}
+			response <- err
+		case evt := <-tbg.Events.History:
+			evt.Response <- tbg.history()
+		case evt := <-tbg.Events.Tags:
+			if evt.Set != nil {
+				tbg.setActiveTags(*evt.Set)
+			}
+			evt.Response <- tbg.tags()
+		case <-tbg.Events.Pause:
+			tbg.pause()
+		case <-tbg.Events.Resume:
+			tbg.resume()
+		case sub := <-tbg.Events.Subscribe:
+			tbg.Subscribers[sub] = struct{}{}
+		case sub := <-tbg.Events.Unsubscribe:
+			delete(tbg.Subscribers, sub)
 		}
 	}
 }
 
+// The current image for goroutines other than TbgState.eventHandler(), which
+// cannot read TbgState.CurrentImage directly. Empty once the event handler
+// returned
+func (tbg *TbgState) currentImage() string {
+	evt := StatusEvent{Response: make(chan StatusResponseBody)}
+	select {
+	case tbg.Events.Status <- evt:
+		return (<-evt.Response).Image
+	case <-tbg.Events.Done:
+		return ""
+	}
+}
+
+// Snapshot of the current state served through /status
+func (tbg *TbgState) status() StatusResponseBody {
+	return StatusResponseBody{
+		Image:     tbg.CurrentImage,
+		Profile:   tbg.Config.ProfileOrDefault(),
+		Alignment: tbg.CurrentAlignment,
+		Opacity:   tbg.CurrentOpacity,
+		Stretch:   tbg.CurrentStretch,
+		Interval:  tbg.interval().String(),
+		Port:      tbg.Config.PortOrDefault(),
+		Paused:    tbg.Paused,
+		Tags:      tbg.ActiveTags,
+		NextImage: func() *time.Time {
+			if tbg.Paused {
+				return nil
+			}
+			// a copy since the response is encoded outside of the event loop
+			next := tbg.NextTick
+			return &next
+		}(),
+	}
+}
+
+// How long the current image stays: the interval of the path it is from, or
+// the global interval
+func (tbg *TbgState) interval() Interval {
+	return tbg.Config.IntervalOf(tbg.CurrentImage)
+}
+
+// When the image should change next after from: after the interval, or at the
+// next time matched by its cron expression, plus a random jitter. Zero if the
+// cron expression never matches
+func (tbg *TbgState) nextTick(from time.Time) time.Time {
+	loc, err := tbg.Config.Location()
+	if err != nil {
+		loc = time.Local
+	}
+	next := tbg.interval().Next(from.In(loc))
+	if next.IsZero() {
+		return next
+	}
+	if jitter := tbg.Config.JitterOrDefault(); jitter > 0 {
+		next = next.Add(rand.N(jitter))
+	}
+	return next
+}
+
+// Longest possible wait from now until the next tick. A restored countdown
+// longer than this is from a different config
+func (tbg *TbgState) maxWait() time.Duration {
+	now := tbg.Config.Now()
+	return tbg.interval().Next(now).Sub(now) + tbg.Config.JitterOrDefault()
+}
+
+// Restarts the countdown of TbgState.imageUpdateTicker(). If paused, the full
+// interval will be waited once resumed instead.
+func (tbg *TbgState) resetTicker() {
+	if tbg.Paused {
+		tbg.PausedRemaining = max(time.Until(tbg.nextTick(time.Now())), 0)
+		return
+	}
+	tbg.NextTick = tbg.nextTick(time.Now())
+	tbg.Events.Reschedule <- tbg.NextTick
+}
+
+// Stops TbgState.imageUpdateTicker() from changing the image until resumed.
+// Manual image changes still work while paused.
+func (tbg *TbgState) pause() {
+	if tbg.Paused {
+		slog.Info("Already paused")
+		return
+	}
+	tbg.Paused = true
+	tbg.PausedRemaining = max(time.Until(tbg.NextTick), 0)
+	tbg.Events.Reschedule <- time.Time{}
+	slog.Info("Paused image changes", "remaining", tbg.PausedRemaining.String())
+	tbg.saveState()
+	tbg.publish(ServerEvent{Type: PauseServerEvent})
+}
+
+// Continues the countdown of TbgState.imageUpdateTicker() from where it was
+// paused. A cron interval continues at its next matching time instead
+func (tbg *TbgState) resume() {
+	if !tbg.Paused {
+		slog.Info("Already running")
+		return
+	}
+	tbg.Paused = false
+	if tbg.interval().Cron != nil {
+		tbg.NextTick = tbg.nextTick(time.Now())
+	} else {
+		tbg.NextTick = time.Now().Add(tbg.PausedRemaining)
+	}
+	tbg.Events.Reschedule <- tbg.NextTick
+	slog.Info("Resumed image changes", "next-image", tbg.NextTick)
+	tbg.saveState()
+	tbg.publish(ServerEvent{Type: ResumeServerEvent})
+}
+
 // Changes the background image to a randomly chosen image from images in dirs
 // under "paths" in the tbg config file
 func (tbg *TbgState) changeToRandomImage(
+	trigger ImageChangeTrigger,
+	filter TagFilter,
 	alignment *string,
-	opacity *float32,
+	opacity *Opacity,
 	stretch *string,
 ) error {
-	currentImage, currentAlignment, currentOpacity, currentStretch, err := tbg.randomImage()
+	currentImage, currentAlignment, currentOpacity, currentStretch, err := tbg.randomImage(filter)
 	if err != nil {
 		return err
 	}
 	currentAlignment = Option(alignment).UnwrapOr(currentAlignment)
 	currentOpacity = Option(opacity).UnwrapOr(currentOpacity)
 	currentStretch = Option(stretch).UnwrapOr(currentStretch)
-	return tbg.setImage(currentImage, currentAlignment, currentOpacity, currentStretch)
+	// the request may ask for "auto" when the config does not
+	currentAlignment, currentStretch = tbg.resolveLayout(currentImage, currentAlignment, currentStretch)
+	return tbg.setImage(trigger, currentImage, currentAlignment, currentOpacity, currentStretch)
 }
 
 // Sets the passed in image path with its properties as the current background
-// image
+// image and notifies subscribers of the /events stream. An "auto" opacity is
+// chosen from the luminance of the image. If the image is processed, its
+// derivative is what is written to settings.json but the image is what is
+// kept in the history and the status. An image in an archive that cannot be
+// extracted is not set, and ErrExtractImage is returned
 func (tbg *TbgState) setImage(
+	trigger ImageChangeTrigger,
 	imagePath string,
 	alignment string,
-	opacity float32,
+	autoOrOpacity Opacity,
 	stretch string,
 ) error {
-	err := tbg.Settings.Write(
-		imagePath,
+	opacity := tbg.resolveOpacity(imagePath, autoOrOpacity)
+	file := tbg.derivative(imagePath)
+	// Windows Terminal cannot read images inside archives
+	file, err := tbg.extract(file)
+	if err != nil {
+		// the archive may have changed since it was scanned
+		slog.Warn("Failed to extract image, keeping the current one",
+			"image", imagePath,
+			"error", err,
+		)
+		return fmt.Errorf("%w: %s", ErrExtractImage, err)
+	}
+	err = tbg.Settings.Write(
+		file,
 		tbg.Config.ProfileOrDefault(),
 		alignment,
 		opacity,
@@ -298,27 +877,94 @@ func (tbg *TbgState) setImage(
 	if err != nil {
 		return err
 	}
+	tbg.CurrentImage = imagePath
+	tbg.CurrentAlignment = alignment
+	tbg.CurrentOpacity = opacity
+	tbg.CurrentStretch = stretch
+	if !trigger.IsHistoryNavigation() {
+		tbg.pushHistory(HistoryEntry{
+			Image:     imagePath,
+			Alignment: alignment,
+			Opacity:   opacity,
+			Stretch:   stretch,
+			Time:      time.Now(),
+		})
+	}
+	tbg.resetTicker()
 	slog.Info("Changed image",
 		"image", imagePath,
 		"profile", tbg.Config.ProfileOrDefault(),
 		"alignment", alignment,
 		"opacity", opacity,
 		"stretch", stretch,
+		"trigger", trigger,
+		"interval", tbg.interval().String(),
 	)
+	tbg.publish(ServerEvent{
+		Type:      ImageServerEvent,
+		Image:     imagePath,
+		Profile:   tbg.Config.ProfileOrDefault(),
+		Alignment: alignment,
+		Opacity:   &opacity,
+		Stretch:   stretch,
+		Trigger:   trigger,
+	})
+	tbg.saveState()
+	tbg.runExecs(tbg.ActiveTags)
 	return nil
 }
 
-// Selects a random image from dirs in "paths" field set in tbg config
-func (tbg *TbgState) randomImage() (string, string, float32, string, error) {
-	randomPath := tbg.Config.Paths[uint16(rand.IntN(len(tbg.Config.Paths)))]
+// Selects an image from dirs in "paths" field set in tbg config according to
+// the "selection" field, using only images that pass the tag filter. Files
+// found while scanning are cached in TbgState.Index, which is saved afterwards.
+// An "auto" alignment or stretch is resolved from the aspect ratio of the image
+func (tbg *TbgState) randomImage(filter TagFilter) (string, string, Opacity, string, error) {
+	var pathIndex int
+	var image string
 	var err error
-	tbg.Images, err = randomPath.Images()
+	tbg.Index.Reload()
+	tbg.updateSchedule()
+	switch tbg.Config.SelectionOrDefault() {
+	case ShuffleSelection:
+		pathIndex, image, err = tbg.shuffledImage(filter)
+	case SequentialSelection:
+		pathIndex, image, err = tbg.sequentialImage(filter)
+	default:
+		pathIndex, image, err = tbg.weightedImage(filter)
+	}
+	if err := tbg.Index.Save(); err != nil {
+		slog.Warn("Failed to save image index", "error", err)
+	}
 	if err != nil {
 		return "", "", 0.0, "", err
 	}
-	return tbg.Images[uint16(rand.IntN(len(tbg.Images)))],
-		Option(tbg.OverrideAlignment).Or(randomPath.Alignment).UnwrapOr(DefaultAlignment),
-		Option(tbg.OverrideOpacity).Or(randomPath.Opacity).UnwrapOr(DefaultOpacity),
-		Option(tbg.OverrideStretch).Or(randomPath.Stretch).UnwrapOr(DefaultStretch),
+	path := tbg.Config.Paths[pathIndex]
+	// set on the line of the image in a playlist
+	props := path.PropsOf(image)
+	scheduled := tbg.Schedule.Props
+	alignment, stretch := tbg.resolveLayout(image,
+		Option(tbg.OverrideAlignment).Or(props.Alignment).Or(path.Alignment).Or(scheduled.Alignment).UnwrapOr(DefaultAlignment),
+		Option(tbg.OverrideStretch).Or(props.Stretch).Or(path.Stretch).Or(scheduled.Stretch).UnwrapOr(DefaultStretch),
+	)
+	return image,
+		alignment,
+		Option(tbg.OverrideOpacity).Or(props.Opacity).Or(path.Opacity).Or(scheduled.Opacity).Or(tbg.Config.Opacity).UnwrapOr(Opacity(DefaultOpacity)),
+		stretch,
 		nil
 }
+
+// Evaluates the schedule at the current time, logging when the active rules
+// change
+func (tbg *TbgState) updateSchedule() {
+	if len(tbg.Config.Schedule) == 0 {
+		return
+	}
+	schedule := tbg.Config.ScheduleAt(tbg.Config.Now())
+	if !slices.Equal(schedule.Rules, tbg.Schedule.Rules) || tbg.Schedule.Rules == nil {
+		slog.Info("Schedule changed",
+			"from", tbg.Config.ruleNames(tbg.Schedule.Rules),
+			"to", tbg.Config.ruleNames(schedule.Rules),
+		)
+	}
+	tbg.Schedule = schedule
+}
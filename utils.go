@@ -2,38 +2,16 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-// Specifically, checks if the given path points to an image file that is
-// supported by Windows Terminal (png, jpeg, gif)
+// Specifically, checks if the given path points to an image file in any of
+// the SupportedFormats. See ImageFormat()
 func IsImageFile(path string) bool {
-	handle, err := os.Open(path)
-	if err != nil {
-		return false
-	}
-	defer handle.Close()
-	buf := make([]byte, 512) // 512 according to docs
-	if _, err := handle.Read(buf); err != nil {
-		return false
-	}
-	mime := strings.Split(http.DetectContentType(buf), "/")
-	if len(mime) != 2 {
-		return false
-	}
-	if mime[0] != "image" {
-		return false
-	}
-	switch mime[1] {
-	case "png", "jpeg", "gif":
-		return true
-	default:
-		return false
-	}
+	return ImageFormat(path) != ""
 }
 
 // normalized path to: